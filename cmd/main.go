@@ -1,208 +1,367 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"gospider/internal"
+	"gospider"
 	"gospider/utils"
 	"io"
 	"os"
-	"sync"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// listFlag collects the values of a repeatable flag such as -output
+type listFlag []string
+
+func (o *listFlag) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *listFlag) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
 func main() {
 
-	// Print ascii art
-	f, _ := os.Open("../ascii.txt")
-	defer f.Close()
-	data, _ := io.ReadAll(f)
-	fmt.Println(string(data))
+	// Subcommands take over before the crawl flags are parsed
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		os.Exit(runQuery(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "proxies" {
+		os.Exit(runProxies(os.Args[2:]))
+	}
 
 	// Define command line flags
 	startURL := flag.String("url", "", "Starting URL to crawl (required)")
 	maxDomains := flag.Int("domains", 100, "Maximum number of domains to crawl (default 100)")
 	maxURLs := flag.Int("urls", 1000, "Maximum number of URLs to process (default 1000). 0 = unlimited")
+	maxDepth := flag.Int("depth", 0, "Maximum links to follow from the start URL, e.g. 2 = two clicks deep (default 0 = unlimited)")
+	offsiteDepth := flag.Int("offsite-depth", -1, "Maximum links to follow after leaving the start URL's site: 0 = stay on it, 1 = fetch pages it links to elsewhere (default -1 = only -depth applies)")
 	numWorkers := flag.Int("workers", 5, "Number of concurrent workers (default 5)")
 	useProxies := flag.Bool("proxies", false, "Use proxies from proxies.txt file")
+	proxyMode := flag.String("proxy-mode", utils.ProxyRotate, "How to assign proxies: rotate (new proxy per request) or sticky (one proxy per host)")
+	proxyAttempts := flag.Int("proxy-attempts", 3, "Different proxies to try for a request before giving up (default 3)")
 	downloadImages := flag.Bool("images", false, "Download images found during crawling")
 	saveFiles := flag.Bool("save", false, "Save markdown files to disk (default false)")
 	verbose := flag.Bool("verbose", false, "Enable verbose output (show found URLs and detailed processing info)")
+	maxPerHost := flag.Int("per-host", 8, "Maximum concurrent requests to a single host (default 8). 0 = unlimited")
+	hostDelay := flag.Duration("delay", 0, "Minimum delay between requests to the same host, e.g. 500ms (default 0)")
+	stripParams := flag.String("strip-params", "", "Comma-separated extra query parameters to drop when deduplicating URLs (utm_*, fbclid, gclid and session IDs such as jsessionid are always dropped; add sid here if a site uses it for sessions)")
+	honourCanonical := flag.Bool("canonical", false, "Skip pages whose <link rel=\"canonical\"> points at a URL already crawled (default false)")
+	maxAttempts := flag.Int("retries", 3, "Maximum attempts per URL including the first (default 3)")
+	retryDelay := flag.Duration("retry-delay", 500*time.Millisecond, "Initial backoff before retrying, doubled on each attempt (default 500ms)")
+	retryMaxDelay := flag.Duration("retry-max-delay", 30*time.Second, "Longest backoff or Retry-After to wait for (default 30s)")
+	maxHTMLMB := flag.Int64("max-html-mb", 10, "Largest HTML page to download in MB (default 10). 0 = unlimited")
+	maxImageMB := flag.Int64("max-image-mb", 20, "Largest image to download in MB (default 20). 0 = unlimited")
+	maxRedirects := flag.Int("max-redirects", gospider.DefaultMaxRedirects, "Maximum redirect hops to follow per URL (default 10)")
+	processErrors := flag.Bool("process-errors", false, "Convert, save and extract links from 3xx/4xx/5xx pages too (default false)")
+	checkpointDir := flag.String("checkpoint", "", "Directory to periodically save crawl state to (default disabled)")
+	checkpointInterval := flag.Duration("checkpoint-interval", 30*time.Second, "How often to save a checkpoint (default 30s)")
+	resumeDir := flag.String("resume", "", "Resume a crawl from the checkpoint in this directory")
+	respectRobots := flag.Bool("respect-robots", false, "Obey robots.txt rules for every host (default false)")
+	warcMaxMB := flag.Int64("warc-max-mb", gospider.DefaultWARCMaxBytes/(1024*1024), "Start a new WARC file once the current one reaches this size in MB (default 1024). 0 = never")
+	extractMode := flag.String("extract", gospider.ExtractFull, "What to convert to markdown: full (whole page) or readability (main article content only)")
+	rulesFile := flag.String("rules", "", "JSON file of CSS-selector rules that extract structured records from matching pages")
+	frontMatter := flag.Bool("front-matter", true, "Start saved markdown files with YAML front matter holding the page's metadata (default true)")
+	var outputs listFlag
+	flag.Var(&outputs, "output", "Where to write pages, repeatable: markdown[:dir], jsonl[:path], records[:path] (path \"-\" = stdout), warc[:dir] or sqlite[:path]")
+	scopeMode := flag.String("scope", gospider.ScopeAny, "Which hosts to crawl: host (the start URL's host), domain (its registrable domain, subdomains included) or any")
+	var allowPatterns, denyPatterns, pathPrefixes listFlag
+	flag.Var(&allowPatterns, "allow", "Only crawl URLs matching this regular expression, repeatable (a URL must match at least one)")
+	flag.Var(&denyPatterns, "deny", "Skip URLs matching this regular expression, repeatable")
+	flag.Var(&pathPrefixes, "path-prefix", "Only crawl URLs whose path starts with this prefix, e.g. /docs/, repeatable")
+	denyExtensions := flag.String("deny-ext", "", "Comma-separated file extensions to skip, e.g. pdf,zip,mp4")
 
 	// Parse command line flags
 	flag.Parse()
 
+	// -save is shorthand for the markdown tree under output/
+	if *saveFiles {
+		outputs = append(outputs, "markdown")
+	}
+
+	// Keep stdout clean for JSON Lines by sending all log output to stderr
+	var logw io.Writer = os.Stdout
+	for _, spec := range outputs {
+		if gospider.WritesToStdout(spec) {
+			logw = os.Stderr
+			break
+		}
+	}
+
+	// Print ascii art
+	f, _ := os.Open("../ascii.txt")
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	fmt.Fprintln(logw, string(data))
+
+	// Resuming picks up the start URL and keeps checkpointing into the same directory
+	var checkpoint *gospider.Checkpoint
+	if *resumeDir != "" {
+		cp, err := gospider.LoadCheckpoint(*resumeDir)
+		if err != nil {
+			fmt.Fprintln(logw, "Error: could not resume:", err)
+			return
+		}
+		checkpoint = cp
+		if *startURL == "" && len(cp.Seeds) > 0 {
+			*startURL = cp.Seeds[0] // the rest come back with the checkpoint
+		}
+		if *checkpointDir == "" {
+			*checkpointDir = *resumeDir
+		}
+	}
+
 	// Validate required flags
 	if *startURL == "" {
-		fmt.Println("Error: -url flag is required")
-		fmt.Println("Usage: go run main.go -url=https://example.com [-domains=3] [-urls=1000] [-workers=5] [-images] [-verbose]")
+		fmt.Fprintln(logw, "Error: -url flag is required")
+		fmt.Fprintln(logw, "Usage: go run main.go -url=https://example.com [-domains=3] [-urls=1000] [-workers=5] [-images] [-verbose]")
 		flag.PrintDefaults()
 		return
 	}
+	var rules *utils.RuleSet
+	if *rulesFile != "" {
+		loaded, err := utils.LoadRules(*rulesFile)
+		if err != nil {
+			fmt.Fprintln(logw, "Error loading rules:", err)
+			return
+		}
+		rules = loaded
+	}
+	if *proxyMode != utils.ProxyRotate && *proxyMode != utils.ProxySticky {
+		fmt.Fprintf(logw, "Error: -proxy-mode must be %q or %q\n", utils.ProxyRotate, utils.ProxySticky)
+		return
+	}
+	if *scopeMode != gospider.ScopeHost && *scopeMode != gospider.ScopeDomain && *scopeMode != gospider.ScopeAny {
+		fmt.Fprintf(logw, "Error: -scope must be %q, %q or %q\n", gospider.ScopeHost, gospider.ScopeDomain, gospider.ScopeAny)
+		return
+	}
+	if *extractMode != gospider.ExtractFull && *extractMode != gospider.ExtractReadability {
+		fmt.Fprintf(logw, "Error: -extract must be %q or %q\n", gospider.ExtractFull, gospider.ExtractReadability)
+		return
+	}
 
-	// Record start time
-	startTime := time.Now()
-
-	fmt.Println("\nwelcome to gospider by aryan randeriya")
-	fmt.Printf("Starting URL: %s\n", *startURL)
-	fmt.Printf("Max domains: %d\n", *maxDomains)
-	fmt.Printf("Max URLs: %d\n", *maxURLs)
-	fmt.Printf("Workers: %d\n", *numWorkers)
-	fmt.Printf("Using proxies: %t\n", *useProxies)
-	fmt.Printf("Download images: %t\n", *downloadImages)
-	fmt.Printf("Save files: %t\n", *saveFiles)
-	fmt.Printf("Verbose mode: %t\n", *verbose)
+	fmt.Fprintln(logw, "\nwelcome to gospider by aryan randeriya")
+	fmt.Fprintf(logw, "Starting URL: %s\n", *startURL)
+	fmt.Fprintf(logw, "Max domains: %d\n", *maxDomains)
+	fmt.Fprintf(logw, "Max URLs: %d\n", *maxURLs)
+	if *maxDepth > 0 {
+		fmt.Fprintf(logw, "Max depth: %d\n", *maxDepth)
+	}
+	if *offsiteDepth >= 0 {
+		fmt.Fprintf(logw, "Max off-site depth: %d\n", *offsiteDepth)
+	}
+	fmt.Fprintf(logw, "Workers: %d\n", *numWorkers)
+	fmt.Fprintf(logw, "Max requests per host: %d\n", *maxPerHost)
+	fmt.Fprintf(logw, "Per-host delay: %s\n", *hostDelay)
+	fmt.Fprintf(logw, "Using proxies: %t\n", *useProxies)
+	if *useProxies {
+		fmt.Fprintf(logw, "Proxy mode: %s (%d attempts per request)\n", *proxyMode, *proxyAttempts)
+	}
+	fmt.Fprintf(logw, "Scope: %s\n", *scopeMode)
+	if len(allowPatterns) > 0 {
+		fmt.Fprintf(logw, "Allow: %s\n", strings.Join(allowPatterns, " "))
+	}
+	if len(denyPatterns) > 0 {
+		fmt.Fprintf(logw, "Deny: %s\n", strings.Join(denyPatterns, " "))
+	}
+	if len(pathPrefixes) > 0 {
+		fmt.Fprintf(logw, "Path prefixes: %s\n", pathPrefixes.String())
+	}
+	if *denyExtensions != "" {
+		fmt.Fprintf(logw, "Denied extensions: %s\n", *denyExtensions)
+	}
+	fmt.Fprintf(logw, "Download images: %t\n", *downloadImages)
+	fmt.Fprintf(logw, "Extract: %s\n", *extractMode)
+	if rules != nil {
+		fmt.Fprintf(logw, "Rules: %s (%d rules)\n", *rulesFile, len(rules.Rules))
+	}
+	fmt.Fprintf(logw, "Outputs: %s\n", outputs.String())
+	fmt.Fprintf(logw, "Verbose mode: %t\n", *verbose)
+	fmt.Fprintf(logw, "Respect robots.txt: %t\n", *respectRobots)
+	if *checkpointDir != "" {
+		fmt.Fprintf(logw, "Checkpoint directory: %s (every %s)\n", *checkpointDir, *checkpointInterval)
+	}
+	if checkpoint != nil {
+		fmt.Fprintf(logw, "Resuming from: %s (%d URLs pending)\n", *resumeDir, len(checkpoint.Frontier))
+	}
 
-	// Load proxies if requested
+	// Load proxies if requested, falling back to direct connections if none are usable
+	var proxyPool *utils.ProxyPool
 	if *useProxies {
 		if *verbose {
-			fmt.Println("Loading proxies...")
+			fmt.Fprintln(logw, "Loading proxies...")
+		}
+		proxyList, err := utils.ParseProxies("proxies.txt", *verbose, logw)
+		if err == nil {
+			proxyPool, err = utils.NewProxyPool(proxyList, *proxyMode, *verbose)
+		}
+		if err != nil {
+			fmt.Fprintf(logw, "Warning: Could not load proxies, using direct connections: %v\n", err)
+		} else {
+			proxyPool.SetLogOutput(logw)
+			fmt.Fprintf(logw, "Loaded %d proxies (%s mode)\n", proxyPool.Len(), *proxyMode)
 		}
-		utils.LoadProxies("proxies.txt", *verbose)
 	}
 
-	// Initialize your custom queue - this stores URLs waiting to be processed
-	queue := internal.NewQueue(*maxDomains, *maxURLs, *verbose)
-	queue.Enqueue(*startURL) // Add the starting URL to begin crawling
-
-	// Create a channel to communicate URLs between main thread and worker threads
-	urlChannel := make(chan string, 10000) // much larger buffer for 1000 workers
-	var wg sync.WaitGroup                  // WaitGroup tracks how many workers are currently processing URLs
+	// Build the output sinks before any worker starts
+	var sinks []gospider.Sink
+	for _, spec := range outputs {
+		sink, err := gospider.NewSink(spec, gospider.SinkOptions{
+			Stdout:       os.Stdout,
+			Log:          logw,
+			WARCMaxBytes: *warcMaxMB * 1024 * 1024,
+			FrontMatter:  *frontMatter,
+			Verbose:      *verbose,
+		})
+		if err != nil {
+			fmt.Fprintln(logw, "Error:", err)
+			gospider.MultiSink(sinks).Close()
+			return
+		}
+		sinks = append(sinks, sink)
+	}
 
-	// Start multiple worker goroutines (run in background)
-	if *verbose {
-		fmt.Printf("Starting %d workers...\n", *numWorkers)
+	retryPolicy := gospider.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = *maxAttempts
+	retryPolicy.BaseDelay = *retryDelay
+	retryPolicy.MaxDelay = *retryMaxDelay
+
+	options := []gospider.Option{
+		gospider.WithSeeds(*startURL),
+		gospider.WithMaxDomains(*maxDomains),
+		gospider.WithMaxURLs(*maxURLs),
+		gospider.WithMaxDepth(*maxDepth),
+		gospider.WithMaxOffsiteDepth(*offsiteDepth),
+		gospider.WithWorkers(*numWorkers),
+		gospider.WithPoliteness(*maxPerHost, *hostDelay),
+		gospider.WithSink(sinks...),
+		gospider.WithScope(*scopeMode),
+		gospider.WithAllow(allowPatterns...),
+		gospider.WithDeny(denyPatterns...),
+		gospider.WithPathPrefixes(pathPrefixes...),
+		gospider.WithCanonical(*honourCanonical),
+		gospider.WithRobots(*respectRobots),
+		gospider.WithRetry(retryPolicy),
+		gospider.WithMaxRedirects(*maxRedirects),
+		gospider.WithSizeLimits(*maxHTMLMB*1024*1024, *maxImageMB*1024*1024),
+		gospider.WithExtract(*extractMode),
+		gospider.WithRules(rules),
+		gospider.WithErrorPages(*processErrors),
+		gospider.WithVerbose(*verbose),
+		gospider.WithLogOutput(logw),
+	}
+	if proxyPool != nil {
+		options = append(options, gospider.WithProxyPool(proxyPool, *proxyAttempts))
+	}
+	if *stripParams != "" {
+		options = append(options, gospider.WithStripParams(strings.Split(*stripParams, ",")...))
+	}
+	if *denyExtensions != "" {
+		options = append(options, gospider.WithDenyExtensions(strings.Split(*denyExtensions, ",")...))
+	}
+	if *downloadImages {
+		options = append(options, gospider.WithImages("output"))
 	}
-	for i := 0; i < *numWorkers; i++ {
-		go internal.ProcessAllUrls(urlChannel, &wg, queue, *downloadImages, *saveFiles, *verbose)
+	if *checkpointDir != "" {
+		options = append(options, gospider.WithCheckpoint(*checkpointDir, *checkpointInterval))
+	}
+	if checkpoint != nil {
+		options = append(options, gospider.WithResume(checkpoint))
 	}
 
-	// Progress reporting ticker (every 1 second)
-	progressTicker := time.NewTicker(1 * time.Second)
-	defer progressTicker.Stop()
+	crawler, err := gospider.New(options...)
+	if err != nil {
+		fmt.Fprintln(logw, "Error:", err)
+		gospider.MultiSink(sinks).Close()
+		return
+	}
+
+	// Cancelling crawlCtx aborts in-flight requests; Stop only stops handing out new URLs
+	crawlCtx, forceStop := context.WithCancel(context.Background())
+	defer forceStop()
 
-	// Start progress reporting goroutine
+	// First Ctrl+C drains in-flight work, the second one aborts it
+	var forced atomic.Bool
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		for range progressTicker.C {
-			if !*verbose {
-				elapsed := time.Since(startTime)
-				processedCount := queue.ProcessedCount()
-				completedCount := queue.CompletedCount()
-				domainsCount := queue.DomainsCount()
-				queueSize := queue.Len()
-
-				// Calculate processing rate
-				rate := float64(completedCount) / elapsed.Seconds()
-
-				// Calculate max values for display
-				maxUrlsDisplay := "∞"
-				if *maxURLs > 0 {
-					maxUrlsDisplay = fmt.Sprintf("%d", *maxURLs)
-				}
-
-				// Calculate percentage for domains
-				domainPercent := float64(domainsCount) / float64(*maxDomains) * 100
-
-				// Format time
-				minutes := int(elapsed.Minutes())
-				seconds := int(elapsed.Seconds()) % 60
-				timeStr := fmt.Sprintf("%dm%ds", minutes, seconds)
-
-				fmt.Printf("Processing: %d/%s URLs sent to workers | %d completed | %d/%d domains (%.1f%%) | %d queued | %.1f URLs/sec | %s\n",
-					processedCount, maxUrlsDisplay, completedCount, domainsCount, *maxDomains, domainPercent, queueSize, rate, timeStr)
-			}
-		}
+		<-sigChan
+		fmt.Fprintln(logw, "\nInterrupted, finishing in-flight requests (press Ctrl+C again to force exit)...")
+		crawler.Stop()
+
+		<-sigChan
+		fmt.Fprintln(logw, "\nForcing exit...")
+		forced.Store(true)
+		forceStop()
 	}()
 
-	// Main loop: Move URLs from our queue to the channel for workers to process
-	consecutiveEmptyChecks := 0
-	for {
-		// Try to get a URL from the queue
-		url, successfullyPopped := queue.Dequeue()
-
-		if !successfullyPopped {
-			consecutiveEmptyChecks++
-
-			// Give workers time to discover and add new URLs
-			time.Sleep(10 * time.Millisecond)
-
-			// If queue has been empty for multiple checks, wait for workers
-			if consecutiveEmptyChecks >= 5 {
-				// Wait for all active workers to complete
-				wg.Wait()
-
-				// Final check after workers are done
-				url, successfullyPopped = queue.Dequeue()
-				if !successfullyPopped {
-					// Queue is still empty after workers finished
-					if *verbose {
-						if queue.IsCrawlingComplete() {
-							fmt.Println("Crawling complete - domain limit reached and queue is empty.")
-						} else {
-							fmt.Println("All URLs processed. Shutting down...")
-						}
-					}
-					break
-				}
-				// Reset counter if we found a URL
-				consecutiveEmptyChecks = 0
-			} else {
-				// Try to get another URL before the next iteration
-				continue
+	// Progress reporting ticker (every 1 second)
+	progressTicker := time.NewTicker(1 * time.Second)
+	defer progressTicker.Stop()
+	if !*verbose {
+		go func() {
+			for range progressTicker.C {
+				printProgress(logw, "Processing", crawler.Progress(), *maxURLs, *maxDomains)
 			}
-		} else {
-			// Reset counter on successful dequeue
-			consecutiveEmptyChecks = 0
-		}
+		}()
+	}
 
-		// We got a URL from the queue successfully
-		wg.Add(1)         // Tell WaitGroup we're starting a new task
-		urlChannel <- url // Send the URL to worker for processing
+	result, err := crawler.Run(crawlCtx)
+	progressTicker.Stop()
+	if err != nil {
+		fmt.Fprintln(logw, "Error:", err)
+	}
+	if result != nil {
+		printFinalStats(logw, result, *maxURLs, *maxDomains, *verbose)
+	}
+	if forced.Load() {
+		os.Exit(130)
 	}
+}
 
-	// Close the channel to tell the worker goroutine to stop
-	// This signals that no more URLs will be sent
-	close(urlChannel)
+// printProgress prints a one-line progress update
+func printProgress(w io.Writer, label string, result *gospider.Result, maxURLs int, maxDomains int) {
+	elapsed := result.Duration
 
-	// Stop progress reporting
-	progressTicker.Stop()
+	// Calculate processing rate
+	rate := float64(result.Completed) / elapsed.Seconds()
 
-	// Show final progress update for non-verbose mode
-	if !*verbose {
-		elapsed := time.Since(startTime)
-		processedCount := queue.ProcessedCount()
-		completedCount := queue.CompletedCount()
-		domainsCount := queue.DomainsCount()
-		queueSize := queue.Len()
-
-		// Calculate processing rate
-		rate := float64(completedCount) / elapsed.Seconds()
-
-		// Calculate max values for display
-		maxUrlsDisplay := "∞"
-		if *maxURLs > 0 {
-			maxUrlsDisplay = fmt.Sprintf("%d", *maxURLs)
-		}
+	// Calculate max values for display
+	maxUrlsDisplay := "∞"
+	if maxURLs > 0 {
+		maxUrlsDisplay = fmt.Sprintf("%d", maxURLs)
+	}
 
-		// Calculate percentage for domains
-		domainPercent := float64(domainsCount) / float64(*maxDomains) * 100
+	// Calculate percentage for domains
+	domainPercent := float64(result.Domains) / float64(maxDomains) * 100
 
-		// Format time
-		minutes := int(elapsed.Minutes())
-		seconds := int(elapsed.Seconds()) % 60
-		timeStr := fmt.Sprintf("%dm%ds", minutes, seconds)
+	// Format time
+	minutes := int(elapsed.Minutes())
+	seconds := int(elapsed.Seconds()) % 60
+	timeStr := fmt.Sprintf("%dm%ds", minutes, seconds)
+
+	fmt.Fprintf(w, "%s: %d/%s URLs sent to workers | %d completed | %d/%d domains (%.1f%%) | %d queued | %.1f URLs/sec | %s\n",
+		label, result.Dispatched, maxUrlsDisplay, result.Completed, result.Domains, maxDomains, domainPercent, result.Queued, rate, timeStr)
+}
 
-		fmt.Printf("Final: %d/%s URLs sent to workers | %d completed | %d/%d domains (%.1f%%) | %d queued | %.1f URLs/sec | %s\n",
-			processedCount, maxUrlsDisplay, completedCount, domainsCount, *maxDomains, domainPercent, queueSize, rate, timeStr)
+// printFinalStats prints the final progress line and the crawl summary
+func printFinalStats(w io.Writer, result *gospider.Result, maxURLs int, maxDomains int, verbose bool) {
+	// Show final progress update for non-verbose mode
+	if !verbose {
+		printProgress(w, "Final", result, maxURLs, maxDomains)
 	}
 
 	// Calculate total execution time
-	totalTime := time.Since(startTime)
-	completedCount := queue.CompletedCount()
-	processedCount := queue.ProcessedCount()
-	visitedCount := queue.VisitedCount()
-	domainsCount := queue.DomainsCount()
-	queueSize := queue.Len()
+	totalTime := result.Duration
+	completedCount := result.Completed
+	processedCount := result.Dispatched
 
 	urlsPerSecond := float64(completedCount) / totalTime.Seconds()
 
@@ -227,14 +386,124 @@ func main() {
 	}
 
 	// Print final statistics with better formatting
-	fmt.Printf("\n=== Crawling Complete ===\n")
-	fmt.Printf("Total execution time: %s\n", timeDisplay)
-	fmt.Printf("Unique URLs discovered: %s\n", formatNumber(visitedCount))
-	fmt.Printf("URLs sent to workers: %s\n", formatNumber(processedCount))
-	fmt.Printf("URLs successfully processed: %s (%.1f%% success rate)\n", formatNumber(completedCount), successRate)
-	fmt.Printf("Domains processed: %s\n", formatNumber(domainsCount))
-	fmt.Printf("URLs remaining in queue: %s\n", formatNumber(queueSize))
-	fmt.Printf("Processing rate: %.1f URLs/second\n", urlsPerSecond)
+	fmt.Fprintf(w, "\n=== Crawling Complete ===\n")
+	fmt.Fprintf(w, "Total execution time: %s\n", timeDisplay)
+	fmt.Fprintf(w, "Unique URLs discovered: %s\n", formatNumber(result.Discovered))
+	fmt.Fprintf(w, "URLs sent to workers: %s\n", formatNumber(processedCount))
+	fmt.Fprintf(w, "URLs successfully processed: %s (%.1f%% success rate)\n", formatNumber(completedCount), successRate)
+	fmt.Fprintf(w, "URLs failed after retries: %s (%s retries)\n", formatNumber(result.Failed), formatNumber(result.Retries))
+	fmt.Fprintf(w, "Domains processed: %s\n", formatNumber(result.Domains))
+	fmt.Fprintf(w, "URLs remaining in queue: %s\n", formatNumber(result.Queued))
+	fmt.Fprintf(w, "Processing rate: %.1f URLs/second\n", urlsPerSecond)
+	if result.RobotsExcluded > 0 {
+		fmt.Fprintf(w, "URLs excluded by robots.txt: %s\n", formatNumber(result.RobotsExcluded))
+	}
+
+	printScopeExcluded(w, result.ScopeExcluded)
+	printDepthBreakdown(w, result.Stats)
+	printStatusBreakdown(w, result.Stats)
+	printSchemaTypes(w, result.Stats)
+	if result.Proxies != nil {
+		printProxyStats(w, result.Proxies)
+	}
+}
+
+// printProxyStats shows how each proxy performed
+func printProxyStats(w io.Writer, stats []utils.ProxyStats) {
+	const maxProxiesShown = 20
+
+	fmt.Fprintf(w, "\n=== Proxies ===\n")
+	fmt.Fprintf(w, "%-30s %8s %8s %10s  %s\n", "Proxy", "OK", "Failed", "Latency", "State")
+	for i, proxy := range stats {
+		if i == maxProxiesShown {
+			fmt.Fprintf(w, "... and %s more proxies\n", formatNumber(len(stats)-maxProxiesShown))
+			break
+		}
+		state := "active"
+		if !proxy.BenchedUntil.IsZero() {
+			state = "benched for " + time.Until(proxy.BenchedUntil).Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%-30s %8s %8s %10s  %s\n", proxy.Proxy, formatNumber(proxy.Successes), formatNumber(proxy.Failures),
+			proxy.AvgLatency.Round(time.Millisecond), state)
+	}
+}
+
+// printScopeExcluded lists how many unique URLs each scope rule kept out of the crawl
+func printScopeExcluded(w io.Writer, excluded []gospider.RuleCount) {
+	if len(excluded) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n=== Excluded by Scope ===\n")
+	for _, rule := range excluded {
+		fmt.Fprintf(w, "%-40s %8s URLs\n", rule.Rule, formatNumber(rule.URLs))
+	}
+}
+
+// printDepthBreakdown lists how many URLs were fetched at each depth
+func printDepthBreakdown(w io.Writer, stats *gospider.CrawlStats) {
+	depths := stats.ByDepth()
+	if len(depths) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n=== URLs by Depth ===\n")
+	for _, depth := range depths {
+		fmt.Fprintf(w, "Depth %-4d %8s URLs\n", depth.Depth, formatNumber(depth.URLs))
+	}
+}
+
+// printSchemaTypes lists how many pages carried each structured data type
+func printSchemaTypes(w io.Writer, stats *gospider.CrawlStats) {
+	const maxTypesShown = 20
+
+	types := stats.SchemaTypes()
+	if len(types) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n=== Structured Data by Type ===\n")
+	for i, t := range types {
+		if i == maxTypesShown {
+			fmt.Fprintf(w, "... and %s more types\n", formatNumber(len(types)-maxTypesShown))
+			break
+		}
+		fmt.Fprintf(w, "%-40s %8s pages\n", t.Type, formatNumber(t.Pages))
+	}
+}
+
+// printStatusBreakdown prints fetch outcomes per status class and for the busiest domains
+func printStatusBreakdown(w io.Writer, stats *gospider.CrawlStats) {
+	const maxDomainsShown = 20
+
+	byClass := stats.ByClass()
+	if len(byClass) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n=== Responses by Status ===\n")
+	for _, class := range gospider.StatusClasses {
+		fmt.Fprintf(w, "%-8s %s\n", class.String()+":", formatNumber(byClass[class.String()]))
+	}
+
+	domains := stats.ByDomain()
+	fmt.Fprintf(w, "\n=== Responses by Domain ===\n")
+	fmt.Fprintf(w, "%-40s %8s", "Domain", "Total")
+	for _, class := range gospider.StatusClasses {
+		fmt.Fprintf(w, " %8s", class)
+	}
+	fmt.Fprintln(w)
+	for i, domain := range domains {
+		if i == maxDomainsShown {
+			fmt.Fprintf(w, "... and %s more domains\n", formatNumber(len(domains)-maxDomainsShown))
+			break
+		}
+		fmt.Fprintf(w, "%-40s %8s", domain.Domain, formatNumber(domain.Total))
+		for _, class := range gospider.StatusClasses {
+			fmt.Fprintf(w, " %8s", formatNumber(domain.Counts[class.String()]))
+		}
+		fmt.Fprintln(w)
+	}
 }
 
 // formatNumber adds commas to large numbers for better readability
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gospider/internal"
+	"gospider/utils"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// runProxies implements `gospider proxies check [flags]`
+func runProxies(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "Usage: gospider proxies check [flags]")
+		fmt.Fprintln(os.Stderr, "\nRun `gospider proxies check -h` for the flags.")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("proxies check", flag.ExitOnError)
+	file := flags.String("file", "proxies.txt", "Proxy list to check")
+	out := flags.String("out", "proxies_clean.txt", "Where to write the working proxies, fastest first")
+	testURL := flags.String("test-url", utils.DefaultProxyTestURL, "Page to fetch through each proxy; it should echo the request headers for the anonymity check")
+	timeout := flags.Duration("timeout", 10*time.Second, "Time allowed per proxy")
+	workers := flags.Int("workers", 50, "Proxies to check at once")
+	realIP := flags.String("real-ip", "", "Our public IP, used to spot transparent proxies (default: ask the test URL directly)")
+	minAnonymity := flags.String("min-anonymity", "", "Only keep proxies at least this private: transparent, anonymous or elite (default keep all working)")
+	verbose := flags.Bool("verbose", false, "Print each result as it comes in")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gospider proxies check [flags]")
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args[1:])
+
+	switch *minAnonymity {
+	case "", utils.AnonymityTransparent, utils.AnonymityAnonymous, utils.AnonymityElite:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown -min-anonymity %q (want transparent, anonymous or elite)\n", *minAnonymity)
+		return 2
+	}
+
+	proxies, err := utils.ParseProxies(*file, *verbose, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(proxies) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no valid proxies in %s\n", *file)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Checking %d proxies against %s with %d workers...\n", len(proxies), *testURL, *workers)
+	start := time.Now()
+	results := utils.CheckProxies(ctx, proxies, utils.ProxyCheckOptions{
+		TestURL:   *testURL,
+		Timeout:   *timeout,
+		Workers:   *workers,
+		RealIP:    *realIP,
+		UserAgent: internal.UserAgent,
+		Verbose:   *verbose,
+	})
+
+	// Results come back fastest first, so the clean list keeps that order
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROXY\tSTATUS\tLATENCY\tANONYMITY\tERROR")
+	var clean []string
+	working := 0
+	for _, result := range results {
+		status, latency, errText := "-", "-", ""
+		if result.StatusCode != 0 {
+			status = fmt.Sprint(result.StatusCode)
+		}
+		if result.OK {
+			working++
+			latency = result.Latency.Round(time.Millisecond).String()
+			if *minAnonymity == "" || utils.AnonymityAtLeast(result.Anonymity, *minAnonymity) {
+				clean = append(clean, result.Proxy)
+			}
+		} else {
+			errText = result.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", utils.RedactProxy(result.Proxy), status, latency, result.Anonymity, errText)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d of %d proxies working (%s)\n", working, len(results), time.Since(start).Round(time.Millisecond))
+
+	// An interrupted check would replace the clean list with a partial one
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted: %s left unchanged\n", *out)
+		return 130
+	}
+	if err := utils.WriteCleanProxies(clean, *out); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %d proxies to %s\n", len(clean), *out)
+	return 0
+}
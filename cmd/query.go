@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gospider/internal"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// runQuery implements `gospider query [-db crawl.db] [-limit 20] <report>`
+func runQuery(args []string) int {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	dbPath := flags.String("db", "crawl.db", "Crawl database written by -output=sqlite")
+	limit := flags.Int("limit", 20, "Maximum rows to show")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gospider query [-db=crawl.db] [-limit=20] <report>")
+		fmt.Fprintln(os.Stderr, "\nReports:")
+		for _, report := range internal.Reports {
+			fmt.Fprintf(os.Stderr, "  %-10s %s\n", report.Name, report.Description)
+		}
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	report, ok := internal.FindReport(flags.Arg(0))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown report %q\n", flags.Arg(0))
+		flags.Usage()
+		return 2
+	}
+
+	if _, err := os.Stat(*dbPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	db, err := internal.OpenCrawlDB(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	rows, err := db.Query(report.SQL, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error running %s: %v\n", report.Name, err)
+		return 1
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Print the rows as an aligned table
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		cells := make([]string, len(values))
+		for i, value := range values {
+			switch v := value.(type) {
+			case nil:
+				cells[i] = "-"
+			case []byte:
+				cells[i] = string(v)
+			default:
+				cells[i] = fmt.Sprint(v)
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+		count++
+	}
+	w.Flush()
+	if err := rows.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if count == 0 {
+		fmt.Println("(no rows)")
+	}
+	return 0
+}
@@ -0,0 +1,343 @@
+package gospider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gospider/internal"
+	"gospider/utils"
+	"sync"
+	"time"
+)
+
+// Crawler is one crawl: its own client, frontier, robots.txt cache and outputs
+type Crawler struct {
+	cfg        config
+	queue      *internal.Queue
+	robots     *internal.RobotsCache // nil unless WithRobots
+	scope      *internal.Scope       // nil when every URL is in scope
+	fetch      *internal.FetchOptions
+	sink       Sink // nil when no outputs were given
+	hooks      *internal.Hooks
+	onComplete []func(result *Result)
+	started    time.Time
+	ran        bool
+	stop       chan struct{}
+	stopOnce   sync.Once
+	mu         sync.Mutex
+}
+
+// Result summarises a crawl. Progress returns the same figures while Run is going.
+type Result struct {
+	StartedAt      time.Time
+	Duration       time.Duration
+	Discovered     int // unique URLs seen
+	Dispatched     int // URLs handed to workers
+	Completed      int // URLs fetched and processed
+	Failed         int // URLs that still failed after retries
+	Retries        int
+	Domains        int
+	Queued         int         // URLs left in the frontier
+	RobotsExcluded int         // URLs skipped because of robots.txt
+	ScopeExcluded  []RuleCount // unique URLs each scope rule kept out, most first
+	Interrupted    bool        // Stop was called or the context ended before the frontier drained
+	Stats          *CrawlStats
+	Proxies        []utils.ProxyStats // nil without a proxy pool
+}
+
+// New builds a crawler from options. Nothing is fetched until Run.
+func New(opts ...Option) (*Crawler, error) {
+	c := &Crawler{cfg: defaultConfig(), hooks: &internal.Hooks{}, stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(c)
+	}
+	cfg := &c.cfg
+
+	if len(cfg.seeds) == 0 && cfg.resume == nil {
+		return nil, errors.New("no seed URLs (use WithSeeds or WithResume)")
+	}
+	if cfg.workers < 1 {
+		return nil, fmt.Errorf("need at least one worker, got %d", cfg.workers)
+	}
+	if cfg.extract != ExtractFull && cfg.extract != ExtractReadability {
+		return nil, fmt.Errorf("unknown extract mode %q (want %s or %s)", cfg.extract, ExtractFull, ExtractReadability)
+	}
+
+	client := cfg.client
+	if client == nil {
+		client = internal.NewHTTPClient(cfg.proxyPool, cfg.proxyAttempts)
+		if cfg.verbose && cfg.proxyPool != nil {
+			fmt.Fprintf(cfg.log, "Routing requests through a pool of %d proxies\n", cfg.proxyPool.Len())
+		} else if cfg.verbose {
+			fmt.Fprintln(cfg.log, "Using direct connection (proxies disabled)")
+		}
+	} else {
+		client = internal.TrackRedirects(client)
+		cfg.proxyPool = nil // the caller's client decides how to connect
+	}
+
+	c.queue = internal.NewQueue(cfg.maxDomains, cfg.maxURLs, cfg.verbose)
+	c.queue.SetLogOutput(cfg.log)
+	c.queue.SetPoliteness(cfg.maxPerHost, cfg.hostDelay)
+	c.queue.SetDepthLimits(cfg.maxDepth, cfg.maxOffsite)
+
+	// Deduplicate on normalized URLs, dropping tracking parameters
+	trackingParams := append([]string{}, utils.DefaultTrackingParams...)
+	trackingParams = append(trackingParams, cfg.stripParams...)
+	c.queue.SetNormalizer(utils.NewURLNormalizer(trackingParams), cfg.canonical)
+
+	// Only build a scope when something restricts it
+	if cfg.scopeMode != ScopeAny || len(cfg.allow)+len(cfg.deny)+len(cfg.pathPrefixes)+len(cfg.denyExtensions) > 0 {
+		scope, err := internal.NewScope(cfg.scopeMode, cfg.allow, cfg.deny, cfg.pathPrefixes, cfg.denyExtensions, cfg.verbose)
+		if err != nil {
+			return nil, err
+		}
+		scope.SetLogOutput(cfg.log)
+		c.scope = scope
+		c.queue.SetScope(scope)
+	}
+
+	// Consult robots.txt through the same client the workers use
+	if cfg.respectRobots {
+		c.robots = internal.NewRobotsCache(client, internal.RobotsAgent, cfg.verbose)
+		c.robots.SetLogOutput(cfg.log)
+		c.queue.SetRobots(c.robots)
+	}
+
+	switch len(cfg.sinks) {
+	case 0:
+	case 1:
+		c.sink = cfg.sinks[0]
+	default:
+		c.sink = MultiSink(cfg.sinks)
+	}
+
+	images := utils.NewImageStore(cfg.imageDir)
+	images.SetLogOutput(cfg.log)
+	c.fetch = &internal.FetchOptions{
+		Client:         client,
+		DownloadImages: cfg.downloadImages,
+		Images:         images,
+		Sink:           c.sink,
+		Verbose:        cfg.verbose,
+		Retry:          cfg.retry,
+		MaxRedirects:   cfg.maxRedirects,
+		MaxHTMLBytes:   cfg.maxHTMLBytes,
+		MaxImageBytes:  cfg.maxImageBytes,
+		Extract:        cfg.extract,
+		Rules:          cfg.rules,
+		Hooks:          c.hooks,
+		Log:            cfg.log,
+
+		ProcessErrorPages: cfg.processErrors,
+	}
+	return c, nil
+}
+
+// Stop stops handing out new URLs; Run returns once in-flight requests finish.
+// Cancel Run's context instead to abort in-flight requests too.
+func (c *Crawler) Stop() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+// Run crawls until the frontier is empty, a limit is reached, Stop is called or ctx ends,
+// then closes the outputs and saves a final checkpoint. A Crawler can only run once.
+func (c *Crawler) Run(ctx context.Context) (*Result, error) {
+	c.mu.Lock()
+	if c.ran {
+		c.mu.Unlock()
+		return nil, errors.New("crawler has already run")
+	}
+	c.ran = true
+	c.started = time.Now()
+	c.mu.Unlock()
+
+	cfg := &c.cfg
+	for _, seed := range cfg.seeds {
+		c.queue.AddSeed(seed)
+	}
+	if cfg.resume != nil {
+		c.queue.Restore(cfg.resume) // Continue with the saved frontier and seeds
+	} else {
+		for _, seed := range cfg.seeds {
+			c.queue.Enqueue(seed)
+		}
+	}
+
+	// ctx aborts in-flight requests; dispatchCtx only stops handing out new URLs
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
+	defer stopDispatch()
+	go func() {
+		select {
+		case <-c.stop:
+			stopDispatch()
+		case <-dispatchCtx.Done():
+		}
+	}()
+
+	// Periodically snapshot the frontier
+	if cfg.checkpointDir != "" && cfg.checkpointTick > 0 {
+		checkpointTicker := time.NewTicker(cfg.checkpointTick)
+		defer checkpointTicker.Stop()
+		go func() {
+			for {
+				select {
+				case <-checkpointTicker.C:
+					c.saveCheckpoint(cfg.verbose)
+				case <-dispatchCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// Create a channel to communicate URLs between the dispatcher and worker threads
+	urlChannel := make(chan internal.FrontierEntry, 10000) // much larger buffer for 1000 workers
+	var wg sync.WaitGroup                                  // WaitGroup tracks how many workers are currently processing URLs
+
+	// Start multiple worker goroutines (run in background)
+	if cfg.verbose {
+		fmt.Fprintf(cfg.log, "Starting %d workers...\n", cfg.workers)
+	}
+	for i := 0; i < cfg.workers; i++ {
+		go internal.ProcessAllUrls(ctx, urlChannel, &wg, c.queue, c.fetch)
+	}
+
+	// Main loop: Move URLs from our queue to the channel for workers to process
+	for dispatchCtx.Err() == nil {
+		// Try to get a URL from the queue
+		entry, successfullyPopped := c.queue.Dequeue(dispatchCtx)
+		if successfullyPopped {
+			wg.Add(1)           // Tell WaitGroup we're starting a new task
+			urlChannel <- entry // Send the URL to worker for processing
+			continue
+		}
+
+		// Nothing waiting and nothing in flight that could discover more: wait for the
+		// workers to finish up, then stop unless they queued something at the last moment
+		if c.queue.IsCrawlingComplete() || (c.queue.Len() == 0 && c.queue.InFlightCount() == 0) {
+			wg.Wait()
+			if dispatchCtx.Err() != nil {
+				break
+			}
+			if c.queue.Len() > 0 && !c.queue.IsCrawlingComplete() {
+				continue
+			}
+			if cfg.verbose {
+				if c.queue.IsCrawlingComplete() {
+					fmt.Fprintln(cfg.log, "Crawling complete - domain limit reached and queue is empty.")
+				} else {
+					fmt.Fprintln(cfg.log, "All URLs processed. Shutting down...")
+				}
+			}
+			break
+		}
+
+		// URLs are waiting on busy or cooling-down hosts, or in-flight fetches may find more.
+		// Wait for a host or a worker rather than for every in-flight fetch, so a slow host
+		// cannot starve the others.
+		c.waitForHost(dispatchCtx)
+	}
+	interrupted := dispatchCtx.Err() != nil
+
+	// Hand back URLs that were dispatched but never picked up by a worker
+	if interrupted {
+	drain:
+		for {
+			select {
+			case entry := <-urlChannel:
+				c.queue.Requeue(entry)
+				wg.Done()
+			default:
+				break drain
+			}
+		}
+	}
+
+	// Close the channel to tell the worker goroutines to stop
+	close(urlChannel)
+
+	// Let in-flight requests finish, then flush pending output
+	wg.Wait()
+	var err error
+	if c.sink != nil {
+		if closeErr := c.sink.Close(); closeErr != nil {
+			err = fmt.Errorf("closing output: %w", closeErr)
+		}
+	}
+
+	// Save the final state so a later resume continues from here
+	if cfg.checkpointDir != "" {
+		c.saveCheckpoint(cfg.verbose || ctx.Err() != nil)
+	}
+
+	result := c.Progress()
+	result.Interrupted = interrupted
+	for _, hook := range c.onComplete {
+		hook(result)
+	}
+	return result, err
+}
+
+// maxHostWait bounds how long the dispatcher sleeps on busy hosts before checking again
+const maxHostWait = time.Second
+
+// waitForHost sleeps until a waiting host comes out of its delay, a worker frees a host slot
+// or ctx ends
+func (c *Crawler) waitForHost(ctx context.Context) {
+	wait, ok := c.queue.NextReady()
+	if !ok || wait > maxHostWait {
+		wait = maxHostWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.queue.Released():
+	case <-ctx.Done():
+	}
+}
+
+// Progress returns the crawl's figures so far; it is safe to call while Run is going
+func (c *Crawler) Progress() *Result {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+
+	result := &Result{
+		StartedAt:  started,
+		Discovered: c.queue.VisitedCount(),
+		Dispatched: c.queue.ProcessedCount(),
+		Completed:  c.queue.CompletedCount(),
+		Failed:     c.queue.FailedCount(),
+		Retries:    c.queue.RetryCount(),
+		Domains:    c.queue.DomainsCount(),
+		Queued:     c.queue.Len(),
+		Stats:      c.queue.Stats(),
+	}
+	if !started.IsZero() {
+		result.Duration = time.Since(started)
+	}
+	if c.robots != nil {
+		result.RobotsExcluded = c.robots.ExcludedCount()
+	}
+	if c.scope != nil {
+		result.ScopeExcluded = c.scope.Excluded()
+	}
+	if c.cfg.proxyPool != nil {
+		result.Proxies = c.cfg.proxyPool.Stats()
+	}
+	return result
+}
+
+// saveCheckpoint writes the queue state to the checkpoint directory, logging any failure
+func (c *Crawler) saveCheckpoint(verbose bool) {
+	cp := c.queue.Snapshot()
+	if err := internal.SaveCheckpoint(c.cfg.checkpointDir, cp); err != nil {
+		fmt.Fprintln(c.cfg.log, "Error saving checkpoint:", err)
+		return
+	}
+	if verbose {
+		fmt.Fprintf(c.cfg.log, "Checkpoint saved to %s (%d pending, %d visited)\n", c.cfg.checkpointDir, len(cp.Frontier), len(cp.Visited))
+	}
+}
@@ -0,0 +1,62 @@
+package gospider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// chainSite serves /0, /1, ... where each page links to the next, after delay
+func chainSite(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		var n int
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/"), "%d", &n)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body><a href="/%d">next</a></body></html>`, n+1)
+	}))
+}
+
+func TestSlowHostDoesNotStarveFastHost(t *testing.T) {
+	slow := chainSite(2 * time.Second)
+	defer slow.Close()
+	fast := chainSite(100 * time.Millisecond)
+	defer fast.Close()
+
+	crawler, err := New(
+		WithSeeds(slow.URL+"/0", fast.URL+"/0"),
+		WithMaxURLs(0),
+		WithWorkers(4),
+		WithPoliteness(1, 0),
+		WithRetry(RetryPolicy{MaxAttempts: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fastPages atomic.Int32
+	crawler.OnResponse(func(resp *Response) {
+		if strings.HasPrefix(resp.URL, fast.URL) {
+			fastPages.Add(1)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	if _, err := crawler.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// At 100ms a page the fast host manages over a dozen while the slow host is still on its first
+	if got := fastPages.Load(); got < 8 {
+		t.Errorf("fast host served %d pages while the slow host was busy, want at least 8", got)
+	}
+}
@@ -1,10 +1,23 @@
 module gospider
 
-go 1.24.4
+go 1.26.0
 
-require github.com/JohannesKaufmann/html-to-markdown/v2 v2.3.3
+require (
+	github.com/JohannesKaufmann/html-to-markdown/v2 v2.3.3
+	github.com/andybalholm/cascadia v1.3.5
+	golang.org/x/net v0.55.0
+	modernc.org/sqlite v1.60.1
+)
 
 require (
 	github.com/JohannesKaufmann/dom v0.2.0 // indirect
-	golang.org/x/net v0.39.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-isatty v0.0.24 // indirect
+	github.com/ncruces/go-strftime v1.0.0 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/sys v0.48.0 // indirect
+	modernc.org/libc v1.77.1 // indirect
+	modernc.org/mathutil v1.7.1 // indirect
+	modernc.org/memory v1.12.1 // indirect
 )
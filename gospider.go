@@ -0,0 +1,96 @@
+// Package gospider is an embeddable web crawler. A Crawler is built with options and
+// run with a context:
+//
+//	sink, _ := gospider.NewSink("jsonl:pages.jsonl", gospider.SinkOptions{})
+//	crawler, err := gospider.New(
+//		gospider.WithSeeds("https://example.com"),
+//		gospider.WithMaxURLs(500),
+//		gospider.WithWorkers(10),
+//		gospider.WithSink(sink),
+//	)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	result, err := crawler.Run(ctx)
+//
+// Every Crawler has its own HTTP client, frontier, robots.txt cache and outputs, so
+// several crawls can run in one process.
+//
+// Hooks (OnRequest, OnResponse, OnHTML, OnLink, OnError and OnComplete) must be registered
+// before Run. Except for OnComplete they are called from the worker goroutines, concurrently
+// for different URLs, so they must be safe for concurrent use. For one URL they run in order:
+// OnRequest, OnResponse, OnHTML, OnLink and OnError. Several hooks for the same event run in
+// the order they were registered.
+package gospider
+
+import (
+	"gospider/internal"
+	"os"
+)
+
+// Types shared with the crawler internals
+type (
+	Sink        = internal.Sink        // receives every processed page
+	ErrorSink   = internal.ErrorSink   // optionally implemented by sinks that record failed fetches
+	ArchiveSink = internal.ArchiveSink // optionally implemented by sinks that record every HTTP exchange
+	Exchange    = internal.Exchange    // one raw request and response, handed to ArchiveSink
+	Page        = internal.Page        // the record handed to sinks
+	FetchError  = internal.FetchError  // a URL that failed or returned an error status
+	SinkOptions = internal.SinkOptions // settings for NewSink
+	MultiSink   = internal.MultiSink   // fans pages out to several sinks
+	RetryPolicy = internal.RetryPolicy // how failed requests are retried
+	Checkpoint  = internal.Checkpoint  // saved crawl state, see WithCheckpoint and WithResume
+	CrawlStats  = internal.CrawlStats  // per-status, per-domain and schema type counts
+	StatusClass = internal.StatusClass // outcome bucket of a fetch, e.g. 4xx or timeout
+	RuleCount   = internal.RuleCount   // URLs excluded by one scope rule
+)
+
+// Scope modes for WithScope
+const (
+	ScopeHost   = internal.ScopeHost   // only the seeds' hosts
+	ScopeDomain = internal.ScopeDomain // the seeds' registrable domains, subdomains included
+	ScopeAny    = internal.ScopeAny    // any host, limited only by WithMaxDomains
+)
+
+// Extraction modes for WithExtract
+const (
+	ExtractFull        = internal.ExtractFull
+	ExtractReadability = internal.ExtractReadability
+)
+
+// UserAgent is sent with every request
+const UserAgent = internal.UserAgent
+
+// Defaults for the matching options
+const (
+	DefaultMaxRedirects = internal.DefaultMaxRedirects // WithMaxRedirects
+	DefaultWARCMaxBytes = internal.DefaultWARCMaxBytes // SinkOptions.WARCMaxBytes
+)
+
+// StatusClasses lists the outcome buckets used by CrawlStats, in display order
+var StatusClasses = internal.StatusClasses
+
+// NewSink builds a sink from a spec of the form "kind[:target]": markdown[:dir],
+// jsonl[:path], records[:path], warc[:dir] or sqlite[:path]. A path of "-" writes to
+// opts.Stdout, or os.Stdout when that is nil.
+func NewSink(spec string, opts SinkOptions) (Sink, error) {
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	return internal.NewSinkFromSpec(spec, opts)
+}
+
+// WritesToStdout reports whether a sink spec streams records to stdout
+func WritesToStdout(spec string) bool {
+	return internal.WritesToStdout(spec)
+}
+
+// DefaultRetryPolicy returns the retry settings a Crawler uses unless WithRetry is given
+func DefaultRetryPolicy() RetryPolicy {
+	return internal.DefaultRetryPolicy()
+}
+
+// LoadCheckpoint reads the checkpoint saved in dir, for WithResume
+func LoadCheckpoint(dir string) (*Checkpoint, error) {
+	return internal.LoadCheckpoint(dir)
+}
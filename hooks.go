@@ -0,0 +1,68 @@
+package gospider
+
+import (
+	"gospider/internal"
+	"gospider/utils"
+	"net/http"
+
+	"golang.org/x/net/html"
+)
+
+// Types passed to hooks
+type (
+	Response   = internal.Response   // a final response, before its body is read
+	Link       = utils.Link          // a link found on a page
+	LinkAction = internal.LinkAction // what OnLink hooks decide about a link
+)
+
+// Link hook decisions
+const (
+	LinkDefault  = internal.LinkDefault  // keep the crawler's own decision
+	LinkFollow   = internal.LinkFollow   // enqueue it, even an asset the crawler would skip
+	LinkSkip     = internal.LinkSkip     // do not enqueue it
+	LinkPriority = internal.LinkPriority // enqueue it at the front of its host's queue
+)
+
+// OnRequest is called before every request, retries included. The hook may change the
+// request's headers; returning false vetoes the request and the URL is skipped.
+func (c *Crawler) OnRequest(fn func(req *http.Request) bool) {
+	c.register(func() { c.hooks.Request = append(c.hooks.Request, fn) })
+}
+
+// OnResponse is called for every final response, HTML or not, before its body is read
+func (c *Crawler) OnResponse(fn func(resp *Response)) {
+	c.register(func() { c.hooks.Response = append(c.hooks.Response, fn) })
+}
+
+// OnHTML is called with every parsed page before it is written to the outputs; the hook
+// may change the page record
+func (c *Crawler) OnHTML(fn func(page *Page, doc *html.Node)) {
+	c.register(func() { c.hooks.HTML = append(c.hooks.HTML, fn) })
+}
+
+// OnLink is called for every link found on page from, assets included. The first hook
+// that returns something other than LinkDefault decides what happens to the link.
+func (c *Crawler) OnLink(fn func(from string, link Link) LinkAction) {
+	c.register(func() { c.hooks.Link = append(c.hooks.Link, fn) })
+}
+
+// OnError is called for transport errors, 4xx/5xx responses and pages that could not be read or parsed
+func (c *Crawler) OnError(fn func(fetchErr *FetchError)) {
+	c.register(func() { c.hooks.Error = append(c.hooks.Error, fn) })
+}
+
+// OnComplete is called once from Run, after the workers have stopped and the outputs
+// are closed, with the same result Run returns
+func (c *Crawler) OnComplete(fn func(result *Result)) {
+	c.register(func() { c.onComplete = append(c.onComplete, fn) })
+}
+
+// register adds a hook, refusing once Run has started since workers read hooks without locking
+func (c *Crawler) register(add func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ran {
+		panic("gospider: hooks must be registered before Run")
+	}
+	add()
+}
@@ -0,0 +1,208 @@
+package gospider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// hookSite serves a small site and records every path requested
+type hookSite struct {
+	*httptest.Server
+	mu   sync.Mutex
+	hits []string
+}
+
+func newHookSite(t *testing.T) *hookSite {
+	site := &hookSite{}
+	pages := map[string]string{
+		"/":     `<a href="/a">a</a><a href="/b">b</a><a href="/veto">v</a><a href="/missing">m</a><img src="/pic.png"><a href="/c">c</a>`,
+		"/a":    `<p>a</p>`,
+		"/b":    `<p>b</p>`,
+		"/c":    `<p>c</p>`,
+		"/veto": `<p>veto</p>`,
+	}
+	site.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.mu.Lock()
+		site.hits = append(site.hits, r.URL.Path)
+		site.mu.Unlock()
+		switch body, ok := pages[r.URL.Path]; {
+		case ok:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>" + body + "</body></html>"))
+		case r.URL.Path == "/pic.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<html><body>Not found, try <a href="/a">a</a></body></html>`))
+		}
+	}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+// requested reports whether path was fetched
+func (s *hookSite) requested(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, hit := range s.hits {
+		if hit == path {
+			return true
+		}
+	}
+	return false
+}
+
+// newHookCrawler crawls the site with one worker so hooks run in a predictable order
+func newHookCrawler(t *testing.T, site *hookSite, opts ...Option) *Crawler {
+	t.Helper()
+	crawler, err := New(append([]Option{
+		WithSeeds(site.URL + "/"),
+		WithWorkers(1),
+		WithPoliteness(1, 0),
+		WithRetry(RetryPolicy{MaxAttempts: 1}),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crawler
+}
+
+func TestOnRequestVeto(t *testing.T) {
+	site := newHookSite(t)
+	crawler := newHookCrawler(t, site)
+	crawler.OnRequest(func(req *http.Request) bool {
+		req.Header.Set("X-Test", "1")
+		return req.URL.Path != "/veto"
+	})
+	var responses []string
+	crawler.OnResponse(func(resp *Response) { responses = append(responses, resp.URL) })
+
+	if _, err := crawler.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if site.requested("/veto") {
+		t.Error("vetoed URL was requested")
+	}
+	for _, u := range responses {
+		if strings.HasSuffix(u, "/veto") {
+			t.Error("response hook saw the vetoed URL")
+		}
+	}
+	if !site.requested("/a") {
+		t.Error("other URLs were not crawled")
+	}
+}
+
+func TestOnLinkActions(t *testing.T) {
+	site := newHookSite(t)
+	crawler := newHookCrawler(t, site)
+	crawler.OnLink(func(from string, link Link) LinkAction {
+		switch {
+		case strings.HasSuffix(link.URL, "/b"):
+			return LinkSkip
+		case strings.HasSuffix(link.URL, "/pic.png"):
+			return LinkFollow // an asset the crawler skips without image downloads
+		case strings.HasSuffix(link.URL, "/c"):
+			return LinkPriority
+		}
+		return LinkDefault
+	})
+
+	if _, err := crawler.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if site.requested("/b") {
+		t.Error("skipped link was fetched")
+	}
+	if !site.requested("/pic.png") {
+		t.Error("followed asset was not fetched")
+	}
+	site.mu.Lock()
+	defer site.mu.Unlock()
+	if len(site.hits) < 2 || site.hits[1] != "/c" {
+		t.Errorf("requests = %q, want the priority link /c right after the seed", site.hits)
+	}
+}
+
+func TestOnErrorAndOnComplete(t *testing.T) {
+	site := newHookSite(t)
+	crawler := newHookCrawler(t, site)
+	var errs []*FetchError
+	crawler.OnError(func(fetchErr *FetchError) { errs = append(errs, fetchErr) })
+	var completed []*Result
+	crawler.OnComplete(func(result *Result) { completed = append(completed, result) })
+
+	result, err := crawler.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || !strings.HasSuffix(errs[0].URL, "/missing") || errs[0].StatusCode != http.StatusNotFound || errs[0].Class != "4xx" {
+		t.Errorf("errors = %+v, want one 404 for /missing", errs)
+	}
+	if len(completed) != 1 || completed[0] != result {
+		t.Errorf("OnComplete called %d times, want once with Run's result", len(completed))
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a hook after Run did not panic")
+		}
+	}()
+	crawler.OnError(func(*FetchError) {})
+}
+
+func TestHookCallOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		processErrors bool
+		want          map[string]string
+	}{
+		{"error pages skipped", false, map[string]string{
+			"/":        "request response html link",
+			"/a":       "request response html",
+			"/missing": "request response error",
+		}},
+		{"error pages processed", true, map[string]string{
+			"/":        "request response html link",
+			"/a":       "request response html",
+			"/missing": "request response html link error",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := newHookSite(t)
+			crawler := newHookCrawler(t, site, WithErrorPages(tt.processErrors))
+			events := make(map[string][]string) // path -> hooks called for it, in order
+			record := func(rawURL, event string) {
+				path := strings.TrimPrefix(rawURL, site.URL)
+				events[path] = append(events[path], event)
+			}
+			crawler.OnRequest(func(req *http.Request) bool { record(req.URL.String(), "request"); return true })
+			crawler.OnResponse(func(resp *Response) { record(resp.URL, "response") })
+			crawler.OnHTML(func(page *Page, doc *html.Node) { record(page.URL, "html") })
+			crawler.OnLink(func(from string, link Link) LinkAction {
+				if path := strings.TrimPrefix(from, site.URL); len(events[path]) == 0 || events[path][len(events[path])-1] != "link" {
+					record(from, "link")
+				}
+				return LinkDefault
+			})
+			crawler.OnError(func(fetchErr *FetchError) { record(fetchErr.URL, "error") })
+
+			if _, err := crawler.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			for path, order := range tt.want {
+				if got := strings.Join(events[path], " "); got != order {
+					t.Errorf("hooks for %s = %q, want %q", path, got, order)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxArchiveBytes caps the body kept per exchange, even when the fetch limits are off
+const maxArchiveBytes = 20 << 20
+
+// exchangeRecorderKey is the context key under which Fetch stores its exchangeRecorder
+type exchangeRecorderKey struct{}
+
+// exchangeRecorder collects every exchange of one fetch: redirect hops, retried attempts and the final response
+type exchangeRecorder struct {
+	limit     int64 // largest body kept per exchange
+	mu        sync.Mutex
+	exchanges []*Exchange
+}
+
+// recordingTransport hands every response of a fetch with an exchangeRecorder to it, body included
+type recordingTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	recorder, ok := req.Context().Value(exchangeRecorderKey{}).(*exchangeRecorder)
+	if !ok {
+		return base.RoundTrip(req)
+	}
+
+	start := time.Now()
+	response, err := base.RoundTrip(req)
+	if err != nil {
+		return response, err
+	}
+
+	exchange := &Exchange{
+		Request:    req,
+		Proto:      response.Proto,
+		Status:     response.Status,
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		FetchedAt:  start,
+	}
+	recorder.mu.Lock()
+	recorder.exchanges = append(recorder.exchanges, exchange)
+	recorder.mu.Unlock()
+
+	response.Body = &recordingBody{
+		ReadCloser: response.Body,
+		exchange:   exchange,
+		limit:      recorder.limit,
+		start:      start,
+		eof:        response.ContentLength == 0,
+	}
+	return response, nil
+}
+
+// CloseIdleConnections closes idle connections of the wrapped transport
+func (t *recordingTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// recordingBody copies what is read into the exchange, up to the limit. Bodies are never
+// read just for the archive: one the crawler stops reading early is archived as far as it
+// got and marked truncated.
+type recordingBody struct {
+	io.ReadCloser
+	exchange *Exchange
+	limit    int64
+	start    time.Time
+	body     []byte
+	eof      bool // the whole body was read
+	closed   bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	keep := int(min(int64(n), max(b.limit-int64(len(b.body)), 0)))
+	if keep < n {
+		b.exchange.Truncated = true
+	}
+	b.body = append(b.body, p[:keep]...)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	if !b.eof {
+		b.exchange.Truncated = true
+	}
+	b.exchange.Body = b.body
+	b.exchange.Duration = time.Since(b.start)
+	return b.ReadCloser.Close()
+}
+
+// withExchangeRecorder attaches a recorder to a request context
+func withExchangeRecorder(ctx context.Context, recorder *exchangeRecorder) context.Context {
+	return context.WithValue(ctx, exchangeRecorderKey{}, recorder)
+}
+
+// archiverOf returns the sink as an ArchiveSink if it, or one of the sinks it fans out to, archives exchanges
+func archiverOf(sink Sink) (ArchiveSink, bool) {
+	if multi, ok := sink.(MultiSink); ok {
+		for _, part := range multi {
+			if _, ok := archiverOf(part); ok {
+				return multi, true
+			}
+		}
+		return nil, false
+	}
+	archiver, ok := sink.(ArchiveSink)
+	return archiver, ok
+}
+
+// archiveLimit is the largest body kept per exchange: the larger of the HTML and image
+// limits, and never more than maxArchiveBytes
+func archiveLimit(opts *FetchOptions) int64 {
+	if opts.MaxHTMLBytes <= 0 || opts.MaxImageBytes <= 0 {
+		return maxArchiveBytes
+	}
+	return min(max(opts.MaxHTMLBytes, opts.MaxImageBytes), maxArchiveBytes)
+}
+
+// archiveExchanges hands every exchange of a finished fetch to the archive, the processed page
+// going with the last one
+func archiveExchanges(archiver ArchiveSink, recorder *exchangeRecorder, page *Page, verbose bool, log io.Writer) {
+	recorder.mu.Lock()
+	exchanges := recorder.exchanges
+	recorder.mu.Unlock()
+
+	for i, exchange := range exchanges {
+		if i == len(exchanges)-1 {
+			exchange.Page = page
+		}
+		if err := archiver.Archive(exchange); err != nil && verbose {
+			fmt.Fprintln(log, "Error archiving", exchange.Request.URL, err)
+		}
+	}
+}
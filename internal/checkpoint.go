@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpointFile is the name of the snapshot inside a checkpoint directory
+const checkpointFile = "checkpoint.json"
+
+// Checkpoint is a snapshot of the crawl frontier that can be reloaded with -resume
+type Checkpoint struct {
+	Seeds     []string        `json:"seeds"` // every seed, including where seeds redirected to
+	SavedAt   time.Time       `json:"saved_at"`
+	Frontier  []FrontierEntry `json:"frontier"` // queued URLs, plus in-flight URLs that never finished
+	Visited   []string        `json:"visited"`
+	Domains   []string        `json:"domains"`
+	Processed int             `json:"processed"`
+	Completed int             `json:"completed"`
+	Failed    int             `json:"failed"`
+
+	StatusByDomain map[string]StatusCounts `json:"status_by_domain"`
+	SchemaTypes    map[string]int          `json:"schema_types,omitempty"`
+	Depths         map[int]int             `json:"depths,omitempty"`
+}
+
+// Snapshot captures the queue state. URLs that were dequeued but not released are
+// put back at the front of the frontier so a resumed crawl fetches them again.
+func (q *Queue) Snapshot() *Checkpoint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cp := &Checkpoint{
+		SavedAt:   time.Now(),
+		Frontier:  make([]FrontierEntry, 0, len(q.inFlight)+q.size),
+		Visited:   make([]string, 0, len(q.visited)),
+		Domains:   make([]string, 0, len(q.domains)),
+		Processed: q.processedURLs - len(q.inFlight),
+		Completed: q.completedURLs,
+		Failed:    q.failedURLs,
+
+		StatusByDomain: q.stats.snapshot(),
+		SchemaTypes:    q.stats.snapshotSchemaTypes(),
+		Depths:         q.stats.snapshotDepths(),
+	}
+	for _, entry := range q.inFlight {
+		cp.Frontier = append(cp.Frontier, entry)
+	}
+	for _, host := range q.hostOrder {
+		cp.Frontier = append(cp.Frontier, q.hosts[host].urls...)
+	}
+	cp.Seeds = append(cp.Seeds, q.seedOrder...)
+	for urlStr := range q.visited {
+		cp.Visited = append(cp.Visited, urlStr)
+	}
+	for domain := range q.domains {
+		cp.Domains = append(cp.Domains, domain)
+	}
+	return cp
+}
+
+// Restore loads a checkpoint into an empty queue
+func (q *Queue) Restore(cp *Checkpoint) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, urlStr := range cp.Seeds {
+		q.addSeed(q.normalize(urlStr))
+	}
+	for _, urlStr := range cp.Visited {
+		q.visited[urlStr] = true
+	}
+	for _, domain := range cp.Domains {
+		q.domains[domain] = true
+	}
+	for _, entry := range cp.Frontier {
+		q.visited[q.normalize(entry.URL)] = true
+		q.push(entry, false)
+	}
+	q.processedURLs = cp.Processed
+	q.completedURLs = cp.Completed
+	q.failedURLs = cp.Failed
+	q.stats.restore(cp.StatusByDomain)
+	q.stats.restoreSchemaTypes(cp.SchemaTypes)
+	q.stats.restoreDepths(cp.Depths)
+
+	if q.verbose {
+		fmt.Fprintf(q.log, "Restored checkpoint from %s: %d pending, %d visited, %d domains\n",
+			cp.SavedAt.Format(time.RFC3339), len(cp.Frontier), len(cp.Visited), len(cp.Domains))
+	}
+}
+
+// SaveCheckpoint writes a checkpoint into dir, replacing the previous one atomically
+func SaveCheckpoint(dir string, cp *Checkpoint) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create checkpoint dir: %v", err)
+	}
+
+	// Write to a temp file first so a crash mid-write never corrupts the last good checkpoint
+	tmpPath := filepath.Join(dir, checkpointFile+".tmp")
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %v", err)
+	}
+	if err := json.NewEncoder(file).Encode(cp); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync checkpoint: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close checkpoint: %v", err)
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(dir, checkpointFile)); err != nil {
+		return fmt.Errorf("failed to replace checkpoint: %v", err)
+	}
+	return nil
+}
+
+// LoadCheckpoint reads the checkpoint stored in dir
+func LoadCheckpoint(dir string) (*Checkpoint, error) {
+	file, err := os.Open(filepath.Join(dir, checkpointFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %v", err)
+	}
+	defer file.Close()
+
+	var cp Checkpoint
+	if err := json.NewDecoder(file).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+	return &cp, nil
+}
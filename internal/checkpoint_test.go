@@ -0,0 +1,32 @@
+package internal
+
+import "testing"
+
+func TestRestoreBringsBackEverySeed(t *testing.T) {
+	scope, _ := NewScope(ScopeHost, nil, nil, nil, nil, false)
+	queue := NewQueue(10, 0, false)
+	queue.SetScope(scope)
+	for _, seed := range []string{"https://a.example/", "https://b.example/"} {
+		queue.AddSeed(seed)
+		queue.Enqueue(seed)
+	}
+	queue.EnqueueLink(FrontierEntry{URL: "https://b.example/"}, "https://b.example/more", false)
+	cp := queue.Snapshot()
+
+	resumedScope, _ := NewScope(ScopeHost, nil, nil, nil, nil, false)
+	resumed := NewQueue(10, 0, false)
+	resumed.SetScope(resumedScope)
+	resumed.Restore(cp)
+
+	if len(cp.Seeds) != 2 {
+		t.Errorf("checkpoint seeds = %q, want both", cp.Seeds)
+	}
+	for _, urlStr := range []string{"https://a.example/next", "https://b.example/next"} {
+		if !resumedScope.Allowed(urlStr) {
+			t.Errorf("%s out of scope after resume", urlStr)
+		}
+	}
+	if resumed.Len() != 3 {
+		t.Errorf("resumed frontier has %d URLs, want 3", resumed.Len())
+	}
+}
@@ -1,87 +1,402 @@
 package internal
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"gospider/utils"
 	"io"
 	"net/http"
+	"os"
 	"sync"
+	"time"
 )
 
-func Fetch(url string, wg *sync.WaitGroup, queue *Queue, downloadImages bool, saveFiles bool, verbose bool) {
+// UserAgent is sent with every request the crawler makes
+const UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)"
+
+// Extraction modes for FetchOptions.Extract
+const (
+	ExtractFull        = "full"        // convert the whole document
+	ExtractReadability = "readability" // convert only the main content, falling back to the whole document
+)
+
+// FetchOptions controls what Fetch does with each page
+type FetchOptions struct {
+	Client         *http.Client // shared by every worker, see NewHTTPClient
+	DownloadImages bool
+	Images         *utils.ImageStore // where downloaded images go
+	Sink           Sink              // receives every processed page, nil = discard
+	Verbose        bool
+	Retry          RetryPolicy
+	MaxRedirects   int
+	MaxHTMLBytes   int64          // largest HTML body to download, 0 = unlimited
+	MaxImageBytes  int64          // largest image to download, 0 = unlimited
+	Extract        string         // ExtractFull or ExtractReadability
+	Rules          *utils.RuleSet // CSS-selector rules for structured records, nil = none
+	Hooks          *Hooks         // callbacks for each stage of a URL, nil = none
+	Log            io.Writer      // where verbose messages go, nil = stdout
+
+	// ProcessErrorPages converts and extracts links from non-2xx pages too
+	ProcessErrorPages bool
+}
+
+func Fetch(ctx context.Context, entry FrontierEntry, wg *sync.WaitGroup, queue *Queue, opts *FetchOptions) {
+	url := entry.URL
+	downloadImages, verbose := opts.DownloadImages, opts.Verbose
+	logw := logOutput(opts.Log)
+
+	// Dequeue has already applied robots.txt; this covers URLs dispatched some other way
+	if robots := queue.Robots(); robots != nil && !robots.Allowed(ctx, url) {
+		return
+	}
+
+	// Archival sinks get every exchange of this fetch once it is done, the page with the last one
+	var page *Page
+	if archiver, ok := archiverOf(opts.Sink); ok {
+		recorder := &exchangeRecorder{limit: archiveLimit(opts)}
+		ctx = withExchangeRecorder(ctx, recorder)
+		defer func() {
+			if ctx.Err() == nil {
+				archiveExchanges(archiver, recorder, page, verbose, logw)
+			}
+		}()
+	}
+
 	// Use shared HTTP client with connection pooling
-	client := GetHTTPClient(verbose)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)")
+	client := opts.Client
+	fetchedAt := time.Now()
+	redirects := NewRedirectTracker(url, queue, opts.MaxRedirects, verbose)
+	response, err := fetchWithRetry(WithRedirectTracker(ctx, redirects), client, url, opts.Retry, opts.Hooks, queue, verbose, logw)
 
-	response, err := client.Do(req)
+	// Aborted requests are not counted anywhere so a resumed crawl can retry them
+	if ctx.Err() != nil {
+		if response != nil {
+			response.Body.Close()
+		}
+		return
+	}
+	if errors.Is(err, errVetoed) {
+		if verbose {
+			fmt.Fprintln(logw, "Skipping URL vetoed by request hook:", url)
+		}
+		return
+	}
+	if err == nil {
+		hookResponse := &Response{
+			URL:        url,
+			FinalURL:   response.Request.URL.String(),
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			Header:     response.Header,
+			Elapsed:    time.Since(fetchedAt),
+		}
+		if redirects.Redirected() {
+			hookResponse.Redirects = redirects.Chain
+		}
+		opts.Hooks.onResponse(hookResponse)
+	}
+
+	status := ClassifyResponse(response, err)
+	queue.RecordStatus(url, status)
+	queue.Stats().RecordDepth(entry.Depth)
+
+	switch {
+	case err != nil:
+		reportError(opts, url, 0, status, err.Error(), fetchedAt)
+	case status == Status4xx || status == Status5xx:
+		// Reported once the URL is done, so with ProcessErrorPages the error hooks
+		// still come after the HTML and link hooks
+		defer reportError(opts, url, response.StatusCode, status, response.Status, fetchedAt)
+	}
 
 	if err != nil {
 		if verbose {
-			fmt.Println("Error while trying to fetch url: ", url, err)
+			fmt.Fprintln(logw, "Error while trying to fetch url: ", url, err)
 		}
+		queue.MarkFailed()
 		return
 	}
 
 	// always close the request body to prevent resource leakage
 	defer response.Body.Close()
 
+	// A status that is still retryable here means we ran out of attempts. With
+	// ProcessErrorPages the page is still processed, but already counted as failed.
+	gaveUp := opts.Retry.RetryableStatus[response.StatusCode]
+	if gaveUp {
+		if verbose {
+			fmt.Fprintf(logw, "Giving up on %s: %s\n", url, response.Status)
+		}
+		queue.MarkFailed()
+		if !opts.ProcessErrorPages {
+			return
+		}
+	}
+
+	// Only successful pages are converted and mined for links unless asked otherwise
+	if status != Status2xx && !opts.ProcessErrorPages {
+		if verbose {
+			fmt.Fprintf(logw, "Skipping %s page: %s (%s)\n", status, url, response.Status)
+		}
+		return
+	}
+
 	// Get content type to determine how to handle the content
 	contentType := response.Header.Get("Content-Type")
 
-	// Read the response body
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
+	// Decide from the headers alone whether the body is worth downloading
+	var limit int64
+	switch {
+	case utils.IsImage(contentType):
+		if !downloadImages {
+			return
+		}
+		limit = opts.MaxImageBytes
+	case utils.IsHTML(contentType):
+		limit = opts.MaxHTMLBytes
+	default:
 		if verbose {
-			fmt.Println("Error reading body:", err)
+			fmt.Fprintf(logw, "Skipping non-HTML content: %s (Content-Type: %s)\n", url, contentType)
+		}
+		return
+	}
+	if limit > 0 && response.ContentLength > limit {
+		if verbose {
+			fmt.Fprintf(logw, "Skipping %s: Content-Length %d exceeds limit of %d bytes\n", url, response.ContentLength, limit)
 		}
 		return
 	}
 
-	// Check if it's an image
+	// Images are streamed straight to disk instead of being held in memory
 	if utils.IsImage(contentType) {
-		if downloadImages {
-			go utils.DownloadImage(body, url, verbose)
+		if err := opts.Images.SaveImageStream(response.Body, url, limit, verbose); err != nil && verbose {
+			fmt.Fprintf(logw, "Error saving image %s: %v\n", url, err)
 		}
 		return
 	}
 
-	// Check if it's processable HTML/text content
-	if !utils.IsHTML(contentType) {
+	// Read the HTML body, refusing anything over the limit even without a Content-Length
+	reader := io.Reader(response.Body)
+	if limit > 0 {
+		reader = io.LimitReader(response.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
 		if verbose {
-			fmt.Printf("Skipping non-HTML content: %s (Content-Type: %s)\n", url, contentType)
+			fmt.Fprintln(logw, "Error reading body:", err)
+		}
+		reportError(opts, url, response.StatusCode, StatusError, err.Error(), fetchedAt)
+		if !gaveUp {
+			queue.MarkFailed()
+		}
+		return
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		if verbose {
+			fmt.Fprintf(logw, "Skipping %s: body exceeds limit of %d bytes\n", url, limit)
 		}
 		return
 	}
 
-	// Process HTML content
-	markdown := ConvertToMarkdown(string(body), url)
+	duration := time.Since(fetchedAt)
+
+	// Links are resolved against the URL we ended up at after redirects
+	finalURL := response.Request.URL.String()
+	doc, err := utils.ParseHTML(string(body))
+	if err != nil {
+		if verbose {
+			fmt.Fprintln(logw, "Error parsing HTML:", url, err)
+		}
+		reportError(opts, url, response.StatusCode, StatusError, err.Error(), fetchedAt)
+		if !gaveUp {
+			queue.MarkFailed()
+		}
+		return
+	}
+	links := utils.ExtractLinksFromDocument(doc, finalURL)
 
-	// Save to file only if saveFiles flag is enabled
-	if saveFiles {
-		SaveMarkdownToFile(markdown, url, verbose)
+	// Skip pages whose canonical URL has already been crawled or queued
+	if queue.HonoursCanonical() {
+		if canonical, ok := canonicalLink(links); ok {
+			self := queue.Normalize(canonical) == queue.Normalize(url) || queue.Normalize(canonical) == queue.Normalize(finalURL)
+			if !self && !queue.MarkVisited(canonical) {
+				if verbose {
+					fmt.Fprintf(logw, "Skipping duplicate of canonical %s: %s\n", canonical, url)
+				}
+				if !gaveUp {
+					queue.MarkCompleted()
+				}
+				return
+			}
+		}
 	}
 
-	urls := utils.ExtractURLs(string(body))
-	urls_md := utils.ExtractURLs(markdown)
+	// Count schema.org and OpenGraph types for the final summary
+	structured := utils.ExtractStructuredData(doc, finalURL)
+	queue.Stats().RecordSchemaTypes(structured.SchemaTypes())
 
-	// Combine URLs from both sources and remove duplicates
-	urlSet := make(map[string]bool)
-	for _, u := range urls {
-		urlSet[u] = true
-	}
-	for _, u := range urls_md {
-		urlSet[u] = true
+	// Process HTML content and hand the page to the hooks and the configured outputs
+	if opts.Sink != nil || opts.Hooks.hasHTML() {
+		content := string(body)
+		if opts.Extract == ExtractReadability {
+			if main, ok := utils.ExtractMainContent(doc); ok {
+				content = main
+			} else if verbose {
+				fmt.Fprintf(logw, "No clear main content in %s, converting the full page\n", url)
+			}
+		}
+
+		page = &Page{
+			URL:        url,
+			FinalURL:   finalURL,
+			StatusCode: response.StatusCode,
+			Headers:    response.Header,
+			Title:      utils.ExtractTitle(doc),
+			Meta:       utils.ExtractMeta(doc, links),
+			Markdown:   ConvertToMarkdown(content, finalURL),
+			Links:      links,
+			Records:    opts.Rules.Extract(doc, finalURL),
+			Structured: structured,
+			FetchedAt:  fetchedAt,
+			Duration:   duration,
+			Depth:      entry.Depth,
+			Parent:     entry.Parent,
+			Request:    response.Request,
+			Proto:      response.Proto,
+			Status:     response.Status,
+			Body:       body,
+		}
+		if page.Meta.Language == "" {
+			page.Meta.Language = response.Header.Get("Content-Language")
+		}
+		if structured.IsEmpty() {
+			page.Structured = nil
+		}
+		if redirects.Redirected() {
+			page.Redirects = redirects.Chain
+		}
+		opts.Hooks.onHTML(page, doc)
+		if opts.Sink != nil {
+			if err := opts.Sink.Write(page); err != nil && verbose {
+				fmt.Fprintln(logw, "Error writing output for", url, err)
+			}
+		}
 	}
 
-	// Iterate over all unique urls and add to the queue for processing
-	for url := range urlSet {
+	// Enqueue pages, and images only when we are going to download them, unless a hook says otherwise
+	for _, link := range links {
+		follow := link.Kind != utils.LinkAsset || (downloadImages && (link.Tag == "img" || link.Tag == "source"))
+		action := opts.Hooks.onLink(finalURL, link)
+		switch action {
+		case LinkFollow, LinkPriority:
+			follow = true
+		case LinkSkip:
+			follow = false
+		}
+		if !follow {
+			continue
+		}
 		if verbose {
-			fmt.Println("Found URL:", url)
+			fmt.Fprintf(logw, "Found URL: %s (%s <%s>)\n", link.URL, link.Kind, link.Tag)
 		}
-		queue.Enqueue(url)
+		queue.EnqueueLink(entry, link.URL, action == LinkPriority)
 	}
 
 	// Mark this URL as successfully completed
-	queue.MarkCompleted()
+	if !gaveUp {
+		queue.MarkCompleted()
+	}
+}
+
+// reportError hands a failed fetch to the error hooks and to the configured outputs if they record errors
+func reportError(opts *FetchOptions, url string, statusCode int, class StatusClass, message string, fetchedAt time.Time) {
+	fetchErr := &FetchError{
+		URL:        url,
+		StatusCode: statusCode,
+		Class:      class.String(),
+		Message:    message,
+		FetchedAt:  fetchedAt,
+	}
+	opts.Hooks.onError(fetchErr)
+
+	errorSink, ok := opts.Sink.(ErrorSink)
+	if !ok {
+		return
+	}
+	err := errorSink.WriteError(fetchErr)
+	if err != nil && opts.Verbose {
+		fmt.Fprintln(logOutput(opts.Log), "Error recording failure for", url, err)
+	}
+}
+
+// logOutput returns w, or stdout when w is nil
+func logOutput(w io.Writer) io.Writer {
+	if w == nil {
+		return os.Stdout
+	}
+	return w
+}
+
+// canonicalLink returns the first <link rel="canonical"> target
+func canonicalLink(links []utils.Link) (string, bool) {
+	for _, link := range links {
+		if link.Tag == "link" && link.HasRel("canonical") {
+			return link.URL, true
+		}
+	}
+	return "", false
+}
+
+// fetchWithRetry performs a GET, retrying transport errors and retryable statuses with backoff.
+// When retries run out the last response (or error) is returned as is.
+func fetchWithRetry(ctx context.Context, client *http.Client, url string, policy RetryPolicy, hooks *Hooks, queue *Queue, verbose bool, log io.Writer) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		// Each attempt records its own redirect chain
+		if tracker, ok := ctx.Value(redirectTrackerKey{}).(*RedirectTracker); ok {
+			tracker.reset()
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", UserAgent)
+		if !hooks.onRequest(req) {
+			return nil, errVetoed
+		}
+
+		response, err := client.Do(req)
+		if err == nil && !policy.RetryableStatus[response.StatusCode] {
+			return response, nil
+		}
+
+		// Out of attempts: hand back the last response or error so the caller can classify it
+		if attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			return response, err
+		}
+
+		// Work out how long to wait, preferring the server's Retry-After
+		wait := policy.Backoff(attempt)
+		if err == nil {
+			if retryAfter, ok := ParseRetryAfter(response.Header.Get("Retry-After"), time.Now()); ok {
+				if policy.MaxDelay > 0 && retryAfter > policy.MaxDelay {
+					// Coming back sooner than asked would be impolite, so give up instead
+					return response, nil
+				}
+				wait = retryAfter
+			}
+			io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024)) // lets the connection be reused
+			response.Body.Close()
+			err = fmt.Errorf("server returned %s", response.Status)
+		}
+
+		if verbose {
+			fmt.Fprintf(log, "Retrying %s in %s (attempt %d/%d): %v\n", url, wait.Round(time.Millisecond), attempt+1, policy.MaxAttempts, err)
+		}
+		queue.MarkRetried()
+		if !sleepContext(ctx, wait) {
+			return nil, ctx.Err()
+		}
+	}
 }
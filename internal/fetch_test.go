@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchCountsExhaustedRetryOnce(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, `<html><body><a href="/status">status</a></body></html>`)
+	}))
+	defer server.Close()
+
+	queue := NewQueue(10, 0, false)
+	sink := &collectSink{}
+	opts := testFetchOptions(sink)
+	opts.ProcessErrorPages = true
+	fetchOnce(t, queue, opts, server.URL+"/")
+
+	if len(sink.pages) != 1 {
+		t.Errorf("got %d pages, want the 503 page processed", len(sink.pages))
+	}
+	if failed, completed := queue.FailedCount(), queue.CompletedCount(); failed != 1 || completed != 0 {
+		t.Errorf("failed=%d completed=%d, want the URL counted once, as failed", failed, completed)
+	}
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
@@ -22,6 +23,7 @@ type HighSpeedFileWriter struct {
 	numWriters int
 	dirCache   map[string]bool
 	dirMutex   sync.RWMutex
+	log        io.Writer // where verbose messages go, see SetLogOutput
 }
 
 // NewHighSpeedFileWriter creates a new high-speed file writer
@@ -30,6 +32,7 @@ func NewHighSpeedFileWriter(numWriters int) *HighSpeedFileWriter {
 		jobs:       make(chan FileWriteJob, 10000), // Large buffer for batching
 		numWriters: numWriters,
 		dirCache:   make(map[string]bool),
+		log:        os.Stdout,
 	}
 
 	// Start background writer workers
@@ -41,6 +44,11 @@ func NewHighSpeedFileWriter(numWriters int) *HighSpeedFileWriter {
 	return fw
 }
 
+// SetLogOutput sends verbose messages to w instead of stdout; call it before writing files
+func (fw *HighSpeedFileWriter) SetLogOutput(w io.Writer) {
+	fw.log = w
+}
+
 // ensureDirFast creates directory with caching
 func (fw *HighSpeedFileWriter) ensureDirFast(dir string) error {
 	fw.dirMutex.RLock()
@@ -73,7 +81,7 @@ func (fw *HighSpeedFileWriter) worker(id int) {
 		dir := filepath.Dir(job.FilePath)
 		if err := fw.ensureDirFast(dir); err != nil {
 			if job.Verbose {
-				fmt.Printf("Writer %d: Error creating dir %s: %v\n", id, dir, err)
+				fmt.Fprintf(fw.log, "Writer %d: Error creating dir %s: %v\n", id, dir, err)
 			}
 			continue
 		}
@@ -82,7 +90,7 @@ func (fw *HighSpeedFileWriter) worker(id int) {
 		file, err := os.Create(job.FilePath)
 		if err != nil {
 			if job.Verbose {
-				fmt.Printf("Writer %d: Error creating file %s: %v\n", id, job.FilePath, err)
+				fmt.Fprintf(fw.log, "Writer %d: Error creating file %s: %v\n", id, job.FilePath, err)
 			}
 			continue
 		}
@@ -93,7 +101,7 @@ func (fw *HighSpeedFileWriter) worker(id int) {
 		if err != nil {
 			file.Close()
 			if job.Verbose {
-				fmt.Printf("Writer %d: Error writing file %s: %v\n", id, job.FilePath, err)
+				fmt.Fprintf(fw.log, "Writer %d: Error writing file %s: %v\n", id, job.FilePath, err)
 			}
 			continue
 		}
@@ -102,7 +110,7 @@ func (fw *HighSpeedFileWriter) worker(id int) {
 		file.Close()
 
 		if job.Verbose {
-			fmt.Printf("🚀 Writer %d: Saved %s (%d bytes)\n", id, job.FilePath, len(job.Content))
+			fmt.Fprintf(fw.log, "🚀 Writer %d: Saved %s (%d bytes)\n", id, job.FilePath, len(job.Content))
 		}
 	}
 }
@@ -119,7 +127,7 @@ func (fw *HighSpeedFileWriter) WriteFile(filePath string, content []byte, verbos
 	default:
 		// Channel full, write synchronously as fallback
 		if verbose {
-			fmt.Printf("Writer queue full, writing %s synchronously\n", filePath)
+			fmt.Fprintf(fw.log, "Writer queue full, writing %s synchronously\n", filePath)
 		}
 		fw.writeSynchronous(filePath, content, verbose)
 	}
@@ -133,7 +141,7 @@ func (fw *HighSpeedFileWriter) writeSynchronous(filePath string, content []byte,
 	file, err := os.Create(filePath)
 	if err != nil {
 		if verbose {
-			fmt.Printf("Sync write error creating %s: %v\n", filePath, err)
+			fmt.Fprintf(fw.log, "Sync write error creating %s: %v\n", filePath, err)
 		}
 		return
 	}
@@ -144,7 +152,7 @@ func (fw *HighSpeedFileWriter) writeSynchronous(filePath string, content []byte,
 	bufWriter.Flush()
 
 	if verbose {
-		fmt.Printf("Sync saved %s (%d bytes)\n", filePath, len(content))
+		fmt.Fprintf(fw.log, "Sync saved %s (%d bytes)\n", filePath, len(content))
 	}
 }
 
@@ -153,16 +161,3 @@ func (fw *HighSpeedFileWriter) Close() {
 	close(fw.jobs)
 	fw.wg.Wait()
 }
-
-// Global file writer instance
-var globalFileWriter *HighSpeedFileWriter
-var fileWriterOnce sync.Once
-
-// GetFileWriter returns the global file writer instance
-func GetFileWriter() *HighSpeedFileWriter {
-	fileWriterOnce.Do(func() {
-		globalFileWriter = NewHighSpeedFileWriter(16) // 16 dedicated file writers for maximum speed
-		fmt.Println("🚀 High-speed file writer initialized with 16 workers")
-	})
-	return globalFileWriter
-}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FrontMatter renders a page's metadata as a YAML front matter block, ending in a blank line
+func FrontMatter(page *Page) string {
+	var sb strings.Builder
+	sb.WriteString("---\n")
+
+	field := func(key, value string) {
+		if value != "" {
+			sb.WriteString(key + ": " + yamlString(value) + "\n")
+		}
+	}
+
+	field("title", page.Title)
+	field("description", page.Meta.Description)
+	field("url", page.URL)
+	if page.FinalURL != page.URL {
+		field("final_url", page.FinalURL)
+	}
+	field("canonical", page.Meta.Canonical)
+	field("language", page.Meta.Language)
+	field("author", page.Meta.Author)
+	field("published", page.Meta.Published)
+
+	if len(page.Redirects) > 1 {
+		sb.WriteString("redirects:\n")
+		for _, hop := range page.Redirects {
+			sb.WriteString("  - " + yamlString(hop) + "\n")
+		}
+	}
+
+	if types := page.Structured.SchemaTypes(); len(types) > 0 {
+		sb.WriteString("schema_types:\n")
+		for _, t := range types {
+			sb.WriteString("  - " + yamlString(t) + "\n")
+		}
+	}
+	if page.Structured != nil {
+		yamlMap(&sb, "opengraph", page.Structured.OpenGraph)
+		yamlMap(&sb, "twitter", page.Structured.Twitter)
+	}
+
+	sb.WriteString("status: " + strconv.Itoa(page.StatusCode) + "\n")
+	sb.WriteString("depth: " + strconv.Itoa(page.Depth) + "\n")
+	field("parent", page.Parent)
+	field("fetched_at", page.FetchedAt.UTC().Format(time.RFC3339))
+	if page.Body != nil {
+		sum := sha256.Sum256(page.Body)
+		field("content_hash", "sha256:"+hex.EncodeToString(sum[:]))
+	}
+
+	sb.WriteString("---\n\n")
+	return sb.String()
+}
+
+// yamlMap writes a string map as a nested YAML mapping with sorted keys
+func yamlMap(sb *strings.Builder, name string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sb.WriteString(name + ":\n")
+	for _, key := range keys {
+		sb.WriteString("  " + yamlString(key) + ": " + yamlString(values[key]) + "\n")
+	}
+}
+
+// yamlString quotes a value as a YAML double-quoted scalar; JSON string escaping is valid YAML
+func yamlString(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// collectSink keeps every page written to it
+type collectSink struct {
+	mu    sync.Mutex
+	pages []*Page
+}
+
+func (s *collectSink) Write(page *Page) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages = append(s.pages, page)
+	return nil
+}
+
+func (s *collectSink) Close() error { return nil }
+
+// fetchOnce runs Fetch for one URL the way a worker would
+func fetchOnce(t *testing.T, queue *Queue, opts *FetchOptions, urlStr string) {
+	t.Helper()
+	queue.Enqueue(urlStr)
+	entry, ok := queue.Dequeue(context.Background())
+	if !ok {
+		t.Fatalf("could not dequeue %s", urlStr)
+	}
+	var wg sync.WaitGroup
+	Fetch(context.Background(), entry, &wg, queue, opts)
+	queue.Release(entry.URL)
+}
+
+func testFetchOptions(sink Sink) *FetchOptions {
+	retry := DefaultRetryPolicy()
+	retry.MaxAttempts = 1
+	return &FetchOptions{
+		Client:       NewHTTPClient(nil, 1),
+		Sink:         sink,
+		Retry:        retry,
+		MaxRedirects: DefaultMaxRedirects,
+		Extract:      ExtractFull,
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"errors"
+	"gospider/utils"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// errVetoed is returned by fetchWithRetry when a request hook refuses the request
+var errVetoed = errors.New("request vetoed by hook")
+
+// LinkAction is what a link hook decides about a discovered URL
+type LinkAction int
+
+const (
+	LinkDefault  LinkAction = iota // keep the crawler's own decision
+	LinkFollow                     // enqueue it, even an asset the crawler would skip
+	LinkSkip                       // do not enqueue it
+	LinkPriority                   // enqueue it at the front of its host's queue
+)
+
+// Response describes a final response (after redirects and retries), before its body is read.
+// Requests that got no response at all go to the error hooks instead.
+type Response struct {
+	URL        string // URL that was dequeued
+	FinalURL   string // URL the response came from
+	StatusCode int
+	Status     string      // e.g. "200 OK"
+	Header     http.Header // response headers, read-only
+	Redirects  []string    // full chain when redirected, nil otherwise
+	Elapsed    time.Duration
+}
+
+// Hooks are callbacks Fetch invokes while processing a URL. Hooks run on worker goroutines,
+// concurrently for different URLs, so they must be safe for concurrent use. For one URL they
+// are called in order: request (per attempt), response, HTML, link (per link) and error hooks.
+// Several hooks for the same event run in the order they were added.
+type Hooks struct {
+	Request  []func(req *http.Request) bool                  // false vetoes the request and skips the URL
+	Response []func(resp *Response)                          // every final response, HTML or not
+	HTML     []func(page *Page, doc *html.Node)              // parsed pages, before they are written to the outputs
+	Link     []func(from string, link utils.Link) LinkAction // every link found on a page; the first non-default action wins
+	Error    []func(fetchErr *FetchError)                    // transport errors, 4xx/5xx and unreadable pages
+}
+
+// onRequest runs the request hooks, reporting false if any of them vetoed
+func (h *Hooks) onRequest(req *http.Request) bool {
+	if h == nil {
+		return true
+	}
+	for _, hook := range h.Request {
+		if !hook(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// onResponse runs the response hooks
+func (h *Hooks) onResponse(resp *Response) {
+	if h == nil {
+		return
+	}
+	for _, hook := range h.Response {
+		hook(resp)
+	}
+}
+
+// hasHTML reports whether any HTML hook is registered
+func (h *Hooks) hasHTML() bool {
+	return h != nil && len(h.HTML) > 0
+}
+
+// onHTML runs the HTML hooks
+func (h *Hooks) onHTML(page *Page, doc *html.Node) {
+	if h == nil {
+		return
+	}
+	for _, hook := range h.HTML {
+		hook(page, doc)
+	}
+}
+
+// onLink asks the link hooks about a discovered URL
+func (h *Hooks) onLink(from string, link utils.Link) LinkAction {
+	if h == nil {
+		return LinkDefault
+	}
+	for _, hook := range h.Link {
+		if action := hook(from, link); action != LinkDefault {
+			return action
+		}
+	}
+	return LinkDefault
+}
+
+// onError runs the error hooks
+func (h *Hooks) onError(fetchErr *FetchError) {
+	if h == nil {
+		return
+	}
+	for _, hook := range h.Error {
+		hook(fetchErr)
+	}
+}
@@ -3,18 +3,19 @@ package internal
 import (
 	"gospider/utils"
 	"net/http"
-	"sync"
 )
 
-var (
-	httpClient     *http.Client
-	httpClientOnce sync.Once
-)
+// NewHTTPClient creates the client a crawl's workers share. With a proxy pool every request
+// goes through it, trying up to proxyAttempts different proxies per request.
+func NewHTTPClient(pool *utils.ProxyPool, proxyAttempts int) *http.Client {
+	return TrackRedirects(utils.CreateHTTPClient(pool, proxyAttempts))
+}
 
-// GetHTTPClient returns a singleton HTTP client with optimized connection pooling
-func GetHTTPClient(verbose bool) *http.Client {
-	httpClientOnce.Do(func() {
-		httpClient = utils.CreateHTTPClientWithTestedProxy(verbose)
-	})
-	return httpClient
-}
\ No newline at end of file
+// TrackRedirects returns a copy of client whose redirects are recorded and checked
+// against the crawl's limits by Fetch, and whose exchanges are recorded for archival sinks
+func TrackRedirects(client *http.Client) *http.Client {
+	tracked := *client
+	tracked.CheckRedirect = checkRedirect
+	tracked.Transport = &recordingTransport{base: client.Transport}
+	return &tracked
+}
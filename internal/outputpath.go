@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	manifestFile     = "manifest.jsonl"
+	maxSegmentLength = 100 // longer path segments are truncated and suffixed with a hash
+	maxQueryLength   = 60  // longer query strings are replaced by a hash
+)
+
+// windowsReserved are file names Windows refuses to create in any directory
+var windowsReserved = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// ManifestEntry is one line of the manifest: which file a URL was written to
+type ManifestEntry struct {
+	URL  string `json:"url"`
+	File string `json:"file"`
+}
+
+// OutputPaths assigns every URL a unique file under root that mirrors the URL's path,
+// and records each assignment in root/manifest.jsonl
+type OutputPaths struct {
+	root     string
+	claimed  map[string]string // lowercased path -> URL, so case-insensitive filesystems are safe too
+	byURL    map[string]string
+	manifest *os.File
+	writer   *bufio.Writer
+	mu       sync.Mutex
+}
+
+// NewOutputPaths creates a path allocator rooted at root; the manifest is opened on first use
+func NewOutputPaths(root string) *OutputPaths {
+	return &OutputPaths{
+		root:    root,
+		claimed: make(map[string]string),
+		byURL:   make(map[string]string),
+	}
+}
+
+// PathFor returns the file a URL should be written to, with the given extension (e.g. ".md").
+// Asking again for the same URL returns the same path.
+func (op *OutputPaths) PathFor(urlStr string, ext string) (string, error) {
+	base, err := URLToPath(urlStr)
+	if err != nil {
+		return "", err
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if existing, ok := op.byURL[urlStr]; ok {
+		return existing, nil
+	}
+
+	// Different URLs can still sanitize to the same name, so number the losers
+	candidate := filepath.Join(op.root, base+ext)
+	for n := 2; ; n++ {
+		owner, taken := op.claimed[strings.ToLower(candidate)]
+		if !taken || owner == urlStr {
+			break
+		}
+		candidate = filepath.Join(op.root, fmt.Sprintf("%s~%d%s", base, n, ext))
+	}
+
+	op.claimed[strings.ToLower(candidate)] = urlStr
+	op.byURL[urlStr] = candidate
+	if err := op.record(ManifestEntry{URL: urlStr, File: candidate}); err != nil {
+		return candidate, err
+	}
+	return candidate, nil
+}
+
+// record appends an entry to the manifest, opening it on first use
+func (op *OutputPaths) record(entry ManifestEntry) error {
+	if op.writer == nil {
+		if err := os.MkdirAll(op.root, 0755); err != nil {
+			return fmt.Errorf("failed to create output dir: %v", err)
+		}
+		file, err := os.OpenFile(filepath.Join(op.root, manifestFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open manifest: %v", err)
+		}
+		op.manifest = file
+		op.writer = bufio.NewWriter(file)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	op.writer.Write(line)
+	return op.writer.WriteByte('\n')
+}
+
+// Close flushes and closes the manifest
+func (op *OutputPaths) Close() error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if op.writer == nil {
+		return nil
+	}
+	err := op.writer.Flush()
+	if closeErr := op.manifest.Close(); err == nil {
+		err = closeErr
+	}
+	op.writer = nil
+	op.manifest = nil
+	return err
+}
+
+// URLToPath turns a URL into a relative file path (without extension) that mirrors
+// its host and path: https://www.example.com/blog/post?page=2 -> example.com/blog/post__page=2
+func URLToPath(urlStr string) (string, error) {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return "", err
+	}
+
+	// Get domain (remove www. if present)
+	domain := strings.TrimPrefix(strings.ToLower(parsedURL.Host), "www.")
+	if domain == "" {
+		domain = "unknown"
+	}
+	parts := []string{sanitizeSegment(domain)}
+
+	// Mirror the path; a trailing slash means the directory's index page
+	path := parsedURL.EscapedPath()
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, sanitizeSegment(segment))
+	}
+	if len(segments) == 0 || strings.HasSuffix(path, "/") {
+		segments = append(segments, "index")
+	}
+
+	// Encode the query into the file name, hashing it when it is long
+	if parsedURL.RawQuery != "" {
+		query := sanitizeSegment(parsedURL.RawQuery)
+		if len(query) > maxQueryLength {
+			query = "q" + shortHash(parsedURL.RawQuery)
+		}
+		segments[len(segments)-1] += "__" + query
+	}
+
+	return filepath.Join(append(parts, segments...)...), nil
+}
+
+// sanitizeSegment makes one path segment safe to use as a file or directory name
+func sanitizeSegment(segment string) string {
+	if unescaped, err := url.PathUnescape(segment); err == nil {
+		segment = unescaped
+	}
+
+	var sb strings.Builder
+	for _, r := range segment {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			sb.WriteRune('_')
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			sb.WriteRune('_')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	name := strings.Trim(sb.String(), " .")
+	if name == "" {
+		name = "_"
+	}
+
+	// Windows also rejects reserved device names even with an extension
+	stem, _, _ := strings.Cut(strings.ToLower(name), ".")
+	if windowsReserved[stem] {
+		name = "_" + name
+	}
+
+	if len(name) > maxSegmentLength {
+		name = truncateUTF8(name, maxSegmentLength) + "-" + shortHash(name)
+	}
+	return name
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	for n > 0 && n < len(s) && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
+
+// shortHash returns the first 8 hex characters of the SHA-1 of s
+func shortHash(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
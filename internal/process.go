@@ -1,19 +1,26 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"sync"
 )
 
-func ProcessAllUrls(urlChan <-chan string, wg *sync.WaitGroup, queue *Queue, downloadImages bool, saveFiles bool, verbose bool) {
+func ProcessAllUrls(ctx context.Context, urlChan <-chan FrontierEntry, wg *sync.WaitGroup, queue *Queue, opts *FetchOptions) {
 	// This function runs in a separate goroutine (worker thread)
 	// It reads URLs from the channel and processes them one by one
-	for url := range urlChan {
-		if verbose {
-			fmt.Println("Processing:", url)
+	for entry := range urlChan {
+		if opts.Verbose {
+			fmt.Fprintf(logOutput(opts.Log), "Processing: %s (depth %d)\n", entry.URL, entry.Depth)
 		}
 		// Download and parse the HTML content
-		Fetch(url, wg, queue, downloadImages, saveFiles, verbose)
+		Fetch(ctx, entry, wg, queue, opts)
+
+		// Free the host's in-flight slot for the scheduler. Aborted URLs stay
+		// in flight so a checkpoint taken during a forced exit retries them.
+		if ctx.Err() == nil {
+			queue.Release(entry.URL)
+		}
 
 		// Tell the WaitGroup that this worker has finished processing this URL
 		wg.Done()
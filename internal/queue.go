@@ -1,121 +1,571 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"gospider/utils"
+	"io"
+	"net/url"
+	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
+// FrontierEntry is a URL in the frontier with how it was reached
+type FrontierEntry struct {
+	URL     string `json:"url"`
+	Depth   int    `json:"depth"`             // links followed from a seed, 0 for seeds
+	Parent  string `json:"parent,omitempty"`  // page the URL was found on, "" for seeds
+	Offsite int    `json:"offsite,omitempty"` // links followed since leaving the seeds' sites, 0 on them
+}
+
+// hostQueue is the frontier for a single host
+type hostQueue struct {
+	origin        *url.URL // scheme and host, used for robots.txt lookups
+	urls          []FrontierEntry
+	inFlight      int
+	lastRequest   time.Time
+	robotsPending bool // robots.txt is being fetched, see robotsReady
+}
+
 type Queue struct {
-	urls          []string
+	hosts         map[string]*hostQueue
+	hostOrder     []string                 // round-robin order of hosts
+	nextHost      int                      // index in hostOrder to try first on the next Dequeue
+	size          int                      // total URLs waiting across all hosts
+	inFlight      map[string]FrontierEntry // dequeued URLs that have not been released yet
 	visited       map[string]bool
 	domains       map[string]bool
+	seedSites     map[string]bool // registrable domains of the seeds, see AddSeed
+	seeds         map[string]bool // normalized seed URLs, including where seeds redirected to
+	seedOrder     []string        // the same seeds in the order they were added, kept in checkpoints
 	maxDomains    int
 	maxURLs       int
+	maxDepth      int           // 0 = unlimited
+	maxOffsite    int           // links to follow off the seeds' sites, -1 = only maxDepth applies
+	maxPerHost    int           // max in-flight requests per host, 0 = unlimited
+	hostDelay     time.Duration // minimum time between requests to the same host
 	processedURLs int
 	completedURLs int // Successfully processed URLs
+	failedURLs    int // URLs that still failed after all retries
+	retries       int // Retry attempts made across all URLs
+	stats         *CrawlStats
 	mu            sync.Mutex
 	verbose       bool
+	log           io.Writer    // where verbose messages go, see SetLogOutput
+	robots        *RobotsCache // nil unless robots.txt is respected
+	scope         *Scope       // nil = every URL is in scope
+	normalizer    *utils.URLNormalizer
+	canonical     bool          // honour <link rel="canonical"> found while fetching
+	released      chan struct{} // signalled when Release frees a host slot, see Released
 }
 
 func NewQueue(maxDomains int, maxURLs int, verbose bool) *Queue {
 	return &Queue{
-		urls:          make([]string, 0),
+		hosts:         make(map[string]*hostQueue),
+		hostOrder:     make([]string, 0),
+		inFlight:      make(map[string]FrontierEntry),
 		visited:       make(map[string]bool),
 		domains:       make(map[string]bool),
+		seedSites:     make(map[string]bool),
+		seeds:         make(map[string]bool),
 		maxDomains:    maxDomains,
 		maxURLs:       maxURLs,
+		maxOffsite:    -1,
 		processedURLs: 0,
 		verbose:       verbose,
+		log:           os.Stdout,
+		normalizer:    utils.NewURLNormalizer(utils.DefaultTrackingParams),
+		stats:         NewCrawlStats(),
+		released:      make(chan struct{}, 1),
+	}
+}
+
+// SetNormalizer replaces the normalizer used to deduplicate URLs
+func (q *Queue) SetNormalizer(normalizer *utils.URLNormalizer, honourCanonical bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.normalizer = normalizer
+	q.canonical = honourCanonical
+}
+
+// HonoursCanonical reports whether pages should be deduplicated by their canonical link
+func (q *Queue) HonoursCanonical() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.canonical
+}
+
+// normalize returns the deduplication key for a URL, or the URL itself if it cannot be normalized
+func (q *Queue) normalize(urlStr string) string {
+	normalized, err := q.normalizer.Normalize(urlStr)
+	if err != nil {
+		return urlStr
+	}
+	return normalized
+}
+
+// Normalize returns the form of a URL used for deduplication
+func (q *Queue) Normalize(urlStr string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.normalize(urlStr)
+}
+
+// MarkVisited records a URL as seen without queueing it, returning false if it was already known
+func (q *Queue) MarkVisited(urlStr string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	urlStr = q.normalize(urlStr)
+	if q.visited[urlStr] {
+		return false
+	}
+	q.visited[urlStr] = true
+	return true
+}
+
+// SetPoliteness limits concurrent requests per host and spaces out requests to the same host
+func (q *Queue) SetPoliteness(maxPerHost int, hostDelay time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.maxPerHost = maxPerHost
+	q.hostDelay = hostDelay
+}
+
+// SetLogOutput sends the queue's verbose messages to w instead of stdout
+func (q *Queue) SetLogOutput(w io.Writer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.log = w
+}
+
+// SetRobots makes the queue consult robots.txt before accepting URLs
+func (q *Queue) SetRobots(robots *RobotsCache) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.robots = robots
+}
+
+// Robots returns the robots.txt cache, or nil if robots.txt is ignored
+func (q *Queue) Robots() *RobotsCache {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.robots
+}
+
+// SetScope restricts which discovered URLs are enqueued
+func (q *Queue) SetScope(scope *Scope) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.scope = scope
+}
+
+// SetDepthLimits limits how many links are followed from a seed (0 = unlimited) and,
+// separately, how many are followed after leaving the seeds' sites (-1 = no separate limit)
+func (q *Queue) SetDepthLimits(maxDepth int, maxOffsite int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.maxDepth = maxDepth
+	q.maxOffsite = maxOffsite
+}
+
+// AddSeed lets a seed URL and its host into the scope and marks its site as on-site;
+// call it before enqueueing the seed
+func (q *Queue) AddSeed(urlStr string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.addSeed(q.normalize(urlStr))
+}
+
+// addSeed is AddSeed for a normalized URL; the caller holds q.mu
+func (q *Queue) addSeed(urlStr string) {
+	if q.seeds[urlStr] {
+		return
+	}
+	q.seeds[urlStr] = true
+	q.seedOrder = append(q.seedOrder, urlStr)
+	if q.scope != nil {
+		q.scope.AddSeed(urlStr)
+	}
+	if parsedURL, err := url.Parse(urlStr); err == nil && parsedURL.Host != "" {
+		q.seedSites[registrableDomain(strings.ToLower(parsedURL.Hostname()))] = true
 	}
 }
 
+// Enqueue adds a seed URL to the back of its host's queue if it passes the dedup, robots and limit checks
 func (q *Queue) Enqueue(urlStr string) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
+	q.enqueue(FrontierEntry{URL: urlStr}, false)
+}
+
+// EnqueueLink is Enqueue for a URL found on parent's page, one level deeper than parent.
+// With first set it is fetched before the rest of its host's queue.
+func (q *Queue) EnqueueLink(parent FrontierEntry, urlStr string, first bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry := FrontierEntry{URL: urlStr, Depth: parent.Depth + 1, Parent: parent.URL}
+	if !q.onSite(urlStr) {
+		entry.Offsite = parent.Offsite + 1
+	}
+
+	// Depth is checked before deduplication, so a URL skipped here can still be queued
+	// when it is found again closer to a seed
+	if q.maxDepth > 0 && entry.Depth > q.maxDepth {
+		if q.verbose {
+			fmt.Fprintf(q.log, "Skipping URL (max depth %d reached): %s\n", q.maxDepth, urlStr)
+		}
+		return
+	}
+	if q.maxOffsite >= 0 && entry.Offsite > q.maxOffsite {
+		if q.verbose {
+			fmt.Fprintf(q.log, "Skipping off-site URL (max off-site depth %d reached): %s\n", q.maxOffsite, urlStr)
+		}
+		return
+	}
+	q.enqueue(entry, first)
+}
+
+// onSite reports whether a URL shares a registrable domain with one of the seeds
+func (q *Queue) onSite(urlStr string) bool {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	return q.seedSites[registrableDomain(strings.ToLower(parsedURL.Hostname()))]
+}
+
+// enqueue applies the dedup, scope, robots and limit checks; the caller holds q.mu
+func (q *Queue) enqueue(entry FrontierEntry, first bool) {
+	// Deduplicate on the normalized form of the URL, but fetch the URL as it was found
+	entry.URL = stripFragment(entry.URL)
+	key := q.normalize(entry.URL)
 
 	// Skip if already visited
-	if q.visited[urlStr] {
+	if q.visited[key] {
+		return
+	}
+
+	// Skip if the scope rules exclude it
+	if q.scope != nil && !q.scope.Allowed(key) {
+		return
+	}
+
+	// Skip if robots.txt forbids it; hosts not fetched yet are checked again by Dequeue
+	if q.robots != nil && !q.robots.AllowedCached(entry.URL) {
 		return
 	}
 
 	// Check if we've reached max URLs limit
 	if q.maxURLs > 0 && q.processedURLs >= q.maxURLs {
 		if q.verbose {
-			fmt.Printf("Skipping URL (max %d URLs reached): %s\n", q.maxURLs, urlStr)
+			fmt.Fprintf(q.log, "Skipping URL (max %d URLs reached): %s\n", q.maxURLs, entry.URL)
 		}
 		return
 	}
 
 	// Extract domain from URL
-	domain, valid := utils.ExtractDomain(urlStr, q.verbose)
+	domain, valid := utils.ExtractDomain(key, false)
 	if !valid {
+		if q.verbose {
+			fmt.Fprintf(q.log, "Skipping invalid URL: %s\n", entry.URL)
+		}
 		return
 	}
 
 	// Check if we've reached max domains and this is a new domain
-	if !q.domains[domain] && len(q.domains) >= q.maxDomains {
+	if !q.admitDomain(domain) {
 		if q.verbose {
-			fmt.Printf("Skipping new domain (max %d reached): %s\n", q.maxDomains, domain)
+			fmt.Fprintf(q.log, "Skipping new domain (max %d reached): %s\n", q.maxDomains, domain)
 		}
 		return
 	}
 
-	// Track the domain (only if it's new and we haven't hit the limit)
-	if !q.domains[domain] {
-		q.domains[domain] = true
+	// Add to queue
+	if !q.push(entry, first) {
+		return
+	}
+	q.visited[key] = true
+	if q.verbose {
+		fmt.Fprintf(q.log, "Enqueued: %s (Depth: %d, Queue size: %d, Domains: %d, Processed: %d/%d)\n", entry.URL, entry.Depth, q.size, len(q.domains), q.processedURLs, q.maxURLs)
 	}
+}
 
-	// Add to queue
+// admitDomain tracks a domain, returning false if it is new and the domain limit is reached
+func (q *Queue) admitDomain(domain string) bool {
+	if q.domains[domain] {
+		return true
+	}
+	if len(q.domains) >= q.maxDomains {
+		return false
+	}
+	q.domains[domain] = true
+	return true
+}
+
+// ClaimRedirect applies the domain limit to a redirect target and marks it visited,
+// so a page reached through a redirect is not crawled again when linked directly.
+// origin is the URL the fetch started from: when it is a seed, the target becomes a
+// seed too, so a seed redirecting to www. or another host brings that host into scope.
+func (q *Queue) ClaimRedirect(origin, urlStr string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	urlStr = q.normalize(urlStr)
+	if q.visited[urlStr] {
+		return fmt.Errorf("already visited")
+	}
+	fromSeed := q.seeds[q.normalize(origin)]
+	if !fromSeed && q.scope != nil && !q.scope.Allowed(urlStr) {
+		return fmt.Errorf("out of scope")
+	}
+	domain, valid := utils.ExtractDomain(urlStr, false)
+	if !valid {
+		return fmt.Errorf("invalid URL")
+	}
+	if !q.admitDomain(domain) {
+		return fmt.Errorf("domain limit (%d) reached", q.maxDomains)
+	}
 	q.visited[urlStr] = true
-	q.urls = append(q.urls, urlStr)
-	if q.verbose {
-		fmt.Printf("Enqueued: %s (Queue size: %d, Domains: %d, Processed: %d/%d)\n", urlStr, len(q.urls), len(q.domains), q.processedURLs, q.maxURLs)
+	if fromSeed && !q.seeds[urlStr] {
+		q.addSeed(urlStr)
+		if q.verbose {
+			fmt.Fprintf(q.log, "Seed %s redirected to %s, added it as a seed\n", origin, urlStr)
+		}
+	}
+	return nil
+}
+
+// stripFragment drops the #fragment, which never reaches the server
+func stripFragment(urlStr string) string {
+	if i := strings.IndexByte(urlStr, '#'); i >= 0 {
+		return urlStr[:i]
 	}
+	return urlStr
 }
 
-// Remove URL from the front
-func (q *Queue) Dequeue() (string, bool) {
+// parseKey parses the normalized form of a URL, whose host names the URL's sub-queue
+func (q *Queue) parseKey(urlStr string) (*url.URL, error) {
+	return url.Parse(q.normalize(urlStr))
+}
+
+// push adds an entry to the back (or front) of its host's sub-queue, creating the sub-queue if needed
+func (q *Queue) push(entry FrontierEntry, first bool) bool {
+	parsedURL, err := q.parseKey(entry.URL)
+	if err != nil {
+		return false
+	}
+	host := parsedURL.Host
+	hq, ok := q.hosts[host]
+	if !ok {
+		hq = &hostQueue{origin: &url.URL{Scheme: parsedURL.Scheme, Host: parsedURL.Host}}
+		q.hosts[host] = hq
+		q.hostOrder = append(q.hostOrder, host)
+	}
+	if first {
+		hq.urls = append([]FrontierEntry{entry}, hq.urls...)
+	} else {
+		hq.urls = append(hq.urls, entry)
+	}
+	q.size++
+	return true
+}
+
+// hostReady reports whether a host may be sent another request right now
+func (q *Queue) hostReady(hq *hostQueue, now time.Time) bool {
+	if len(hq.urls) == 0 {
+		return false
+	}
+	if q.maxPerHost > 0 && hq.inFlight >= q.maxPerHost {
+		return false
+	}
+	return now.Sub(hq.lastRequest) >= q.delayFor(hq)
+}
+
+// delayFor returns the minimum time between requests to a host
+func (q *Queue) delayFor(hq *hostQueue) time.Duration {
+	// Honour the larger of our own delay and the host's robots.txt Crawl-delay
+	delay := q.hostDelay
+	if q.robots != nil {
+		if crawlDelay := q.robots.CrawlDelay(hq.origin); crawlDelay > delay {
+			delay = crawlDelay
+		}
+	}
+	return delay
+}
+
+// NextReady returns how long until a host with waiting URLs comes out of its delay. Hosts at
+// their in-flight limit are skipped; ok is false when every waiting host is at that limit,
+// in which case the next Release is what frees one.
+func (q *Queue) NextReady() (wait time.Duration, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for _, hq := range q.hosts {
+		if len(hq.urls) == 0 || hq.robotsPending || (q.maxPerHost > 0 && hq.inFlight >= q.maxPerHost) {
+			continue
+		}
+		hostWait := q.delayFor(hq) - now.Sub(hq.lastRequest)
+		if hostWait < 0 {
+			hostWait = 0
+		}
+		if !ok || hostWait < wait {
+			wait, ok = hostWait, true
+		}
+	}
+	return wait, ok
+}
+
+// Released is signalled after Release frees a host slot or a host's robots.txt arrives, so a
+// dispatcher waiting on busy hosts can wake up; several signals may be merged into one
+func (q *Queue) Released() <-chan struct{} {
+	return q.released
+}
+
+// wake signals Released without blocking
+func (q *Queue) wake() {
+	select {
+	case q.released <- struct{}{}:
+	default:
+	}
+}
+
+// robotsReady drops the URLs robots.txt disallows from the front of a host's queue, so they
+// never use up the URL budget or a host slot. A host whose robots.txt is not known yet is
+// skipped while it is fetched in the background, bounded by ctx. The caller holds q.mu.
+func (q *Queue) robotsReady(ctx context.Context, hq *hostQueue) bool {
+	if q.robots == nil {
+		return true
+	}
+	if _, ok := q.robots.CachedRules(hq.origin); !ok {
+		if !hq.robotsPending {
+			hq.robotsPending = true
+			go q.fetchRobots(ctx, hq)
+		}
+		return false
+	}
+	for len(hq.urls) > 0 && !q.robots.AllowedCached(hq.urls[0].URL) {
+		hq.urls = hq.urls[1:]
+		q.size--
+	}
+	return len(hq.urls) > 0
+}
+
+// fetchRobots loads a host's robots.txt and wakes the dispatcher to take its URLs
+func (q *Queue) fetchRobots(ctx context.Context, hq *hostQueue) {
+	q.robots.Rules(ctx, hq.origin)
+	q.mu.Lock()
+	hq.robotsPending = false
+	q.mu.Unlock()
+	q.wake()
+}
+
+// Dequeue removes the next URL, taking hosts in round-robin order and skipping hosts that are
+// busy, cooling down or waiting for robots.txt. ctx bounds the robots.txt fetches it starts.
+func (q *Queue) Dequeue(ctx context.Context) (FrontierEntry, bool) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
 	// Check if we've reached max URLs limit
 	if q.maxURLs > 0 && q.processedURLs >= q.maxURLs {
 		if q.verbose {
-			fmt.Printf("Max URLs limit reached (%d/%d). Stopping crawl.\n", q.processedURLs, q.maxURLs)
+			fmt.Fprintf(q.log, "Max URLs limit reached (%d/%d). Stopping crawl.\n", q.processedURLs, q.maxURLs)
 		}
-		return "", false
+		return FrontierEntry{}, false
 	}
 
-	if len(q.urls) == 0 {
+	if q.size == 0 {
 		if q.verbose {
-			fmt.Println("Queue is empty. No more elements to dequeue (Queue size: 0)")
+			fmt.Fprintln(q.log, "Queue is empty. No more elements to dequeue (Queue size: 0)")
 		}
-		return "", false
+		return FrontierEntry{}, false
 	}
 
-	url := q.urls[0]
-	q.urls = q.urls[1:]
-	q.processedURLs++
-	queueSize := len(q.urls)
-	if q.verbose {
-		fmt.Printf("Dequeued: %s (Queue size: %d, Processed: %d/%d)\n", url, queueSize, q.processedURLs, q.maxURLs)
+	// Walk the hosts once, starting after the host served last time
+	now := time.Now()
+	for i := 0; i < len(q.hostOrder); i++ {
+		idx := (q.nextHost + i) % len(q.hostOrder)
+		hq := q.hosts[q.hostOrder[idx]]
+		if !q.hostReady(hq, now) || !q.robotsReady(ctx, hq) {
+			continue
+		}
+
+		entry := hq.urls[0]
+		hq.urls = hq.urls[1:]
+		hq.inFlight++
+		hq.lastRequest = now
+		q.inFlight[q.normalize(entry.URL)] = entry
+		q.size--
+		q.nextHost = idx + 1
+		q.processedURLs++
+		if q.verbose {
+			fmt.Fprintf(q.log, "Dequeued: %s (Queue size: %d, Processed: %d/%d)\n", entry.URL, q.size, q.processedURLs, q.maxURLs)
+		}
+		return entry, true
 	}
-	return url, true
+
+	// URLs are waiting but every host is busy or cooling down
+	return FrontierEntry{}, false
+}
+
+// Release marks a dequeued URL as finished so its host can take another request
+func (q *Queue) Release(urlStr string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.inFlight, q.normalize(urlStr))
+	parsedURL, err := q.parseKey(urlStr)
+	if err != nil {
+		return
+	}
+	if hq, ok := q.hosts[parsedURL.Host]; ok && hq.inFlight > 0 {
+		hq.inFlight--
+	}
+	q.wake()
+}
+
+// Requeue puts a dispatched URL that was never fetched back at the front of its host's queue
+func (q *Queue) Requeue(entry FrontierEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.inFlight, q.normalize(entry.URL))
+	parsedURL, err := q.parseKey(entry.URL)
+	if err != nil {
+		return
+	}
+	if hq, ok := q.hosts[parsedURL.Host]; ok {
+		if hq.inFlight > 0 {
+			hq.inFlight--
+		}
+		hq.urls = append([]FrontierEntry{entry}, hq.urls...)
+		q.size++
+		q.processedURLs--
+	}
+}
+
+// InFlightCount returns how many dequeued URLs have not been released yet
+func (q *Queue) InFlightCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.inFlight)
 }
 
 // Length of the queue
 func (q *Queue) Len() int {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	return len(q.urls)
+	return q.size
 }
 
 // Check if a URL has been visited
 func (q *Queue) HasVisited(urlStr string) bool {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	return q.visited[urlStr]
+	return q.visited[q.normalize(urlStr)]
 }
 
 // Get the total number of unique URLs visited
@@ -146,7 +596,7 @@ func (q *Queue) IsCrawlingComplete() bool {
 	if q.maxURLs > 0 && q.processedURLs >= q.maxURLs {
 		return true
 	}
-	return len(q.domains) >= q.maxDomains && len(q.urls) == 0
+	return len(q.domains) >= q.maxDomains && q.size == 0
 }
 
 // Mark a URL as successfully completed
@@ -162,3 +612,45 @@ func (q *Queue) CompletedCount() int {
 	defer q.mu.Unlock()
 	return q.completedURLs
 }
+
+// Mark a URL as failed after its retries were exhausted
+func (q *Queue) MarkFailed() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.failedURLs++
+}
+
+// Get the total number of URLs that failed
+func (q *Queue) FailedCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.failedURLs
+}
+
+// Record that a request is being retried
+func (q *Queue) MarkRetried() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.retries++
+}
+
+// Get the total number of retry attempts
+func (q *Queue) RetryCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.retries
+}
+
+// Record the status class of a fetched URL against its domain
+func (q *Queue) RecordStatus(urlStr string, class StatusClass) {
+	domain, valid := utils.ExtractDomain(urlStr, false)
+	if !valid {
+		domain = "unknown"
+	}
+	q.stats.Record(domain, class)
+}
+
+// Get the per-status and per-domain statistics
+func (q *Queue) Stats() *CrawlStats {
+	return q.stats
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEnqueueKeepsURLAsFound(t *testing.T) {
+	q := NewQueue(10, 0, false)
+	q.Enqueue("http://example.com/p?utm_source=x&b=1&a=2#top")
+	q.Enqueue("http://example.com/docs/")
+	q.Enqueue("http://EXAMPLE.com/p?a=2&b=1") // same page as the first once normalized
+
+	var got []string
+	for {
+		entry, ok := q.Dequeue(context.Background())
+		if !ok {
+			break
+		}
+		got = append(got, entry.URL)
+		q.Release(entry.URL)
+	}
+
+	want := []string{"http://example.com/p?utm_source=x&b=1&a=2", "http://example.com/docs/"}
+	if len(got) != len(want) {
+		t.Fatalf("dequeued %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("dequeued[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if !q.HasVisited("http://example.com/docs") {
+		t.Error("/docs not deduplicated against /docs/")
+	}
+}
+
+func TestReleaseFreesHostSlot(t *testing.T) {
+	q := NewQueue(10, 0, false)
+	q.SetPoliteness(1, 0)
+	q.Enqueue("http://Example.com:80/a/")
+	q.Enqueue("http://example.com/b")
+
+	first, ok := q.Dequeue(context.Background())
+	if !ok {
+		t.Fatal("nothing to dequeue")
+	}
+	if _, ok := q.Dequeue(context.Background()); ok {
+		t.Fatal("dequeued a second URL while the host was busy")
+	}
+	q.Release(first.URL)
+	if _, ok := q.Dequeue(context.Background()); !ok {
+		t.Fatal("host still busy after Release")
+	}
+}
+
+func TestNextReadyWaitsForHostDelay(t *testing.T) {
+	q := NewQueue(10, 0, false)
+	q.SetPoliteness(0, time.Hour)
+	q.Enqueue("http://example.com/a")
+	q.Enqueue("http://example.com/b")
+
+	if _, ok := q.Dequeue(context.Background()); !ok {
+		t.Fatal("nothing to dequeue")
+	}
+	wait, ok := q.NextReady()
+	if !ok || wait < 59*time.Minute {
+		t.Errorf("NextReady() = %s, %t; want about an hour", wait, ok)
+	}
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// DefaultMaxRedirects caps how many hops a single fetch may follow
+const DefaultMaxRedirects = 10
+
+// redirectTrackerKey is the context key under which Fetch stores its RedirectTracker
+type redirectTrackerKey struct{}
+
+// RedirectTracker records the redirect chain of one fetch and applies the queue's rules to every hop
+type RedirectTracker struct {
+	Chain   []string // every URL requested, starting with the original one
+	Stopped string   // why the chain was cut short, empty if it completed
+
+	queue   *Queue
+	maxHops int
+	claimed map[string]bool // hops this fetch has claimed, so retries may follow them again
+	verbose bool
+}
+
+// NewRedirectTracker creates a tracker for one fetch of urlStr
+func NewRedirectTracker(urlStr string, queue *Queue, maxHops int, verbose bool) *RedirectTracker {
+	return &RedirectTracker{
+		Chain:   []string{urlStr},
+		queue:   queue,
+		maxHops: maxHops,
+		// The URL itself is already claimed, so /docs -> /docs/ is not "already visited"
+		claimed: map[string]bool{queue.Normalize(urlStr): true},
+		verbose: verbose,
+	}
+}
+
+// WithRedirectTracker attaches a tracker to a request context
+func WithRedirectTracker(ctx context.Context, tracker *RedirectTracker) context.Context {
+	return context.WithValue(ctx, redirectTrackerKey{}, tracker)
+}
+
+// reset starts a new attempt while keeping hops claimed by earlier attempts
+func (t *RedirectTracker) reset() {
+	t.Chain = t.Chain[:1]
+	t.Stopped = ""
+}
+
+// Redirected reports whether the fetch ended somewhere other than where it started
+func (t *RedirectTracker) Redirected() bool {
+	return len(t.Chain) > 1
+}
+
+// stop cuts the chain short; the client then returns the 3xx response as is
+func (t *RedirectTracker) stop(reason string, target string) error {
+	t.Stopped = reason
+	if t.verbose {
+		fmt.Fprintf(t.queue.log, "Not following redirect from %s to %s: %s\n", t.Chain[len(t.Chain)-1], target, reason)
+	}
+	return http.ErrUseLastResponse
+}
+
+// checkRedirect is the CheckRedirect policy installed by TrackRedirects
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	tracker, ok := req.Context().Value(redirectTrackerKey{}).(*RedirectTracker)
+	if !ok {
+		// Requests made outside Fetch (robots.txt) get the standard behaviour
+		if len(via) >= DefaultMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", DefaultMaxRedirects)
+		}
+		return nil
+	}
+
+	target := req.URL.String()
+	normalized := tracker.queue.Normalize(target)
+
+	if len(via) > tracker.maxHops {
+		return tracker.stop(fmt.Sprintf("more than %d redirects", tracker.maxHops), target)
+	}
+	// Compare exact URLs: /docs -> /docs/ normalizes to the same key but is no loop
+	for _, hop := range tracker.Chain {
+		if hop == target {
+			return tracker.stop("redirect loop", target)
+		}
+	}
+
+	// Each hop must pass the same domain and robots rules as a discovered link. Hops that
+	// only differ in normalization (e.g. a trailing slash) were claimed with the URL itself.
+	if !tracker.claimed[normalized] {
+		if robots := tracker.queue.Robots(); robots != nil && !robots.Allowed(req.Context(), target) {
+			return tracker.stop("disallowed by robots.txt", target)
+		}
+		if err := tracker.queue.ClaimRedirect(tracker.Chain[0], target); err != nil {
+			return tracker.stop(err.Error(), target)
+		}
+		tracker.claimed[normalized] = true
+	}
+
+	tracker.Chain = append(tracker.Chain, target)
+	return nil
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchFollowsDirectoryRedirect(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	index := `<html><body><a href="intro.html">Intro</a></body></html>`
+	if err := os.WriteFile(filepath.Join(root, "docs", "index.html"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	defer server.Close()
+
+	queue := NewQueue(10, 0, false)
+	sink := &collectSink{}
+	fetchOnce(t, queue, testFetchOptions(sink), server.URL+"/docs")
+
+	if len(sink.pages) != 1 {
+		t.Fatalf("got %d pages, want 1", len(sink.pages))
+	}
+	page := sink.pages[0]
+	if page.StatusCode != http.StatusOK || page.FinalURL != server.URL+"/docs/" {
+		t.Errorf("got %d from %s, want 200 from %s/docs/", page.StatusCode, page.FinalURL, server.URL)
+	}
+	if got := queue.Stats().ByClass()[Status2xx.String()]; got != 1 {
+		t.Errorf("2xx count = %d, want 1", got)
+	}
+	next, ok := queue.Dequeue(context.Background())
+	if !ok || next.URL != server.URL+"/docs/intro.html" {
+		t.Errorf("next URL = %q, want the link found on /docs/", next.URL)
+	}
+}
+
+func TestFetchStopsRedirectLoop(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/b", http.StatusFound) })
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/a", http.StatusFound) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	queue := NewQueue(10, 0, false)
+	opts := testFetchOptions(&collectSink{})
+	tracker := NewRedirectTracker(server.URL+"/a", queue, DefaultMaxRedirects, false)
+	req, _ := http.NewRequestWithContext(WithRedirectTracker(context.Background(), tracker), "GET", server.URL+"/a", nil)
+	response, err := opts.Client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if tracker.Stopped != "redirect loop" {
+		t.Errorf("stopped = %q, want redirect loop", tracker.Stopped)
+	}
+	if response.StatusCode != http.StatusFound {
+		t.Errorf("status = %d, want the 302 that closed the loop", response.StatusCode)
+	}
+}
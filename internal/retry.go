@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed fetch is attempted again
+type RetryPolicy struct {
+	MaxAttempts     int           // total attempts including the first, 1 = no retries
+	BaseDelay       time.Duration // delay before the first retry, doubled on each attempt
+	MaxDelay        time.Duration // cap for backoff and for Retry-After, 0 = no cap
+	RetryableStatus map[int]bool
+}
+
+// DefaultRetryPolicy retries transport errors and overload/gateway statuses three times in total
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		RetryableStatus: map[int]bool{
+			http.StatusRequestTimeout:      true, // 408
+			http.StatusTooEarly:            true, // 425
+			http.StatusTooManyRequests:     true, // 429
+			http.StatusInternalServerError: true, // 500
+			http.StatusBadGateway:          true, // 502
+			http.StatusServiceUnavailable:  true, // 503
+			http.StatusGatewayTimeout:      true, // 504
+		},
+	}
+}
+
+// Backoff returns the delay before retry number attempt (1-based), with exponential growth and jitter
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || delay < p.MaxDelay) && delay <= math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// Equal jitter: half fixed, half random, so workers that failed together spread out
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// ParseRetryAfter reads a Retry-After header given either as seconds or as an HTTP date
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// sleepContext waits for d, returning false early if ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
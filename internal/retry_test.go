@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration // the delay before jitter, which picks from [want/2, want]
+	}{
+		{"first retry", RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}, 1, time.Second},
+		{"doubles", RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}, 3, 4 * time.Second},
+		{"capped", RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}, 4, 5 * time.Second},
+		{"no cap still grows", RetryPolicy{BaseDelay: time.Second}, 4, 8 * time.Second},
+		{"no cap does not overflow", RetryPolicy{BaseDelay: time.Second}, 100, time.Second << 33},
+		{"no base delay", RetryPolicy{MaxDelay: time.Minute}, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 20 {
+				got := tt.policy.Backoff(tt.attempt)
+				if got < tt.want/2 || got > tt.want {
+					t.Fatalf("Backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{"-5", 0, false},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParseRetryAfter(%q) = %s, %t; want %s, %t", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RobotsAgent is the product token matched against User-agent lines in robots.txt
+const RobotsAgent = "gospider"
+
+// maxRobotsSize caps how much of a robots.txt file is read (RFC 9309 asks for at least 500 KiB)
+const maxRobotsSize = 512 * 1024
+
+// robotsRule is a single Allow or Disallow line
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// RobotsRules holds the rules from one robots.txt file that apply to our user agent
+type RobotsRules struct {
+	rules      []robotsRule
+	CrawlDelay time.Duration
+	Sitemaps   []string
+}
+
+// robotsGroup is one User-agent block while parsing
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+	hasDelay   bool
+}
+
+// ParseRobots parses a robots.txt body and keeps the group that best matches userAgent
+func ParseRobots(body []byte, userAgent string) *RobotsRules {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	var sitemaps []string
+	inAgents := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRobotsSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Strip comments and surrounding whitespace
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive User-agent lines share one group
+			if !inAgents {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				inAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil || value == "" {
+				// An empty Disallow means allow everything, so it adds no rule
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{pattern: value, allow: key == "allow"})
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+				// Honoured in full: the host waits, the other hosts keep going
+				current.crawlDelay = time.Duration(math.MaxInt64)
+				if delay := seconds * float64(time.Second); delay < math.MaxInt64 {
+					current.crawlDelay = time.Duration(delay)
+				}
+				current.hasDelay = true
+			}
+		case "sitemap":
+			// Sitemap lines are global and not tied to any group
+			sitemaps = append(sitemaps, value)
+		default:
+			inAgents = false
+		}
+	}
+
+	rules := &RobotsRules{Sitemaps: sitemaps}
+
+	// Pick the groups with the most specific matching agent, falling back to "*"
+	agent := strings.ToLower(userAgent)
+	bestLen := -1
+	var matched []*robotsGroup
+	for _, group := range groups {
+		for _, name := range group.agents {
+			matchLen := -1
+			if name == "*" {
+				matchLen = 0
+			} else if name == agent {
+				matchLen = len(name)
+			}
+			if matchLen < 0 {
+				continue
+			}
+			if matchLen > bestLen {
+				bestLen = matchLen
+				matched = []*robotsGroup{group}
+			} else if matchLen == bestLen {
+				matched = append(matched, group)
+			}
+			break
+		}
+	}
+
+	// Groups for the same agent are merged
+	for _, group := range matched {
+		rules.rules = append(rules.rules, group.rules...)
+		if group.hasDelay && group.crawlDelay > rules.CrawlDelay {
+			rules.CrawlDelay = group.crawlDelay
+		}
+	}
+
+	return rules
+}
+
+// Allowed reports whether a path (including query string) may be fetched
+func (r *RobotsRules) Allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	// The longest matching pattern wins, and Allow wins a tie
+	bestLen := -1
+	allowed := true
+	for _, rule := range r.rules {
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > bestLen || (len(rule.pattern) == bestLen && rule.allow) {
+			bestLen = len(rule.pattern)
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+// matchRobotsPattern matches a path against a robots pattern supporting * and a trailing $
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	if len(parts) == 1 {
+		return !anchored || pos == len(path)
+	}
+
+	// Match the middle segments left to right
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(path[pos:], part)
+		if i < 0 {
+			return false
+		}
+		pos += i + len(part)
+	}
+
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(path[pos:], last)
+	}
+	return strings.Contains(path[pos:], last)
+}
+
+// robotsEntry is a cache slot so that only one goroutine fetches a given host's robots.txt
+type robotsEntry struct {
+	fetching sync.Mutex // held by the goroutine fetching robots.txt
+	rules    *RobotsRules
+	loaded   bool // guarded by RobotsCache.mu
+}
+
+// RobotsCache fetches robots.txt once per host and answers allow/deny questions
+type RobotsCache struct {
+	client    *http.Client
+	userAgent string
+	hosts     map[string]*robotsEntry
+	excluded  map[string]bool
+	mu        sync.Mutex
+	verbose   bool
+	log       io.Writer // where verbose messages go, see SetLogOutput
+}
+
+// NewRobotsCache creates a robots.txt cache that fetches with the given client
+func NewRobotsCache(client *http.Client, userAgent string, verbose bool) *RobotsCache {
+	return &RobotsCache{
+		client:    client,
+		userAgent: userAgent,
+		hosts:     make(map[string]*robotsEntry),
+		excluded:  make(map[string]bool),
+		verbose:   verbose,
+		log:       os.Stdout,
+	}
+}
+
+// SetLogOutput sends verbose messages to w instead of stdout
+func (rc *RobotsCache) SetLogOutput(w io.Writer) {
+	rc.log = w
+}
+
+// Rules returns the robots rules for the URL's host, fetching robots.txt if needed
+func (rc *RobotsCache) Rules(ctx context.Context, parsedURL *url.URL) *RobotsRules {
+	key := parsedURL.Scheme + "://" + parsedURL.Host
+
+	rc.mu.Lock()
+	entry, ok := rc.hosts[key]
+	if !ok {
+		entry = &robotsEntry{}
+		rc.hosts[key] = entry
+	}
+	rc.mu.Unlock()
+
+	entry.fetching.Lock()
+	defer entry.fetching.Unlock()
+	rc.mu.Lock()
+	loaded, rules := entry.loaded, entry.rules
+	rc.mu.Unlock()
+	if loaded {
+		return rules
+	}
+
+	// A fetch cut short by a cancelled context says nothing about the host, so it is not
+	// cached and the next caller tries again. The caller is giving up anyway.
+	rules = rc.fetch(ctx, key)
+	if ctx.Err() != nil {
+		return &RobotsRules{}
+	}
+	rc.mu.Lock()
+	entry.rules = rules
+	entry.loaded = true
+	rc.mu.Unlock()
+	return rules
+}
+
+// CachedRules returns the robots rules for a host only if they have already been fetched
+func (rc *RobotsCache) CachedRules(parsedURL *url.URL) (*RobotsRules, bool) {
+	key := parsedURL.Scheme + "://" + parsedURL.Host
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	// The entry may exist but still be loading; only report finished fetches
+	entry, ok := rc.hosts[key]
+	if !ok || !entry.loaded {
+		return nil, false
+	}
+	return entry.rules, true
+}
+
+// fetch downloads and parses robots.txt for a scheme://host origin
+func (rc *RobotsCache) fetch(ctx context.Context, origin string) *RobotsRules {
+	robotsURL := origin + "/robots.txt"
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return &RobotsRules{}
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	response, err := rc.client.Do(req)
+	if err != nil {
+		// Unreachable robots.txt means we must assume everything is disallowed
+		if rc.verbose {
+			fmt.Fprintf(rc.log, "Could not fetch %s, disallowing host: %v\n", robotsURL, err)
+		}
+		return &RobotsRules{rules: []robotsRule{{pattern: "/", allow: false}}}
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		body, err := io.ReadAll(io.LimitReader(response.Body, maxRobotsSize))
+		if err != nil {
+			if rc.verbose {
+				fmt.Fprintf(rc.log, "Error reading %s: %v\n", robotsURL, err)
+			}
+			return &RobotsRules{}
+		}
+		rules := ParseRobots(body, rc.userAgent)
+		if rc.verbose {
+			fmt.Fprintf(rc.log, "Loaded %s (%d rules, crawl-delay %s, %d sitemaps)\n", robotsURL, len(rules.rules), rules.CrawlDelay, len(rules.Sitemaps))
+		}
+		return rules
+	case response.StatusCode >= 500:
+		// Server errors are treated as a temporary full disallow
+		if rc.verbose {
+			fmt.Fprintf(rc.log, "%s returned %d, disallowing host\n", robotsURL, response.StatusCode)
+		}
+		return &RobotsRules{rules: []robotsRule{{pattern: "/", allow: false}}}
+	default:
+		// 4xx (and anything else) means there are no restrictions
+		if rc.verbose {
+			fmt.Fprintf(rc.log, "%s returned %d, allowing host\n", robotsURL, response.StatusCode)
+		}
+		return &RobotsRules{}
+	}
+}
+
+// Allowed reports whether urlStr may be crawled, fetching robots.txt for its host if needed
+func (rc *RobotsCache) Allowed(ctx context.Context, urlStr string) bool {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil || parsedURL.Host == "" {
+		return true
+	}
+	return rc.check(parsedURL, rc.Rules(ctx, parsedURL))
+}
+
+// AllowedCached is like Allowed but never fetches; URLs on unknown hosts are allowed for now
+func (rc *RobotsCache) AllowedCached(urlStr string) bool {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil || parsedURL.Host == "" {
+		return true
+	}
+	rules, ok := rc.CachedRules(parsedURL)
+	if !ok {
+		return true
+	}
+	return rc.check(parsedURL, rules)
+}
+
+// check applies rules to a URL and records exclusions
+func (rc *RobotsCache) check(parsedURL *url.URL, rules *RobotsRules) bool {
+	path := parsedURL.EscapedPath()
+	if parsedURL.RawQuery != "" {
+		path += "?" + parsedURL.RawQuery
+	}
+	if rules.Allowed(path) {
+		return true
+	}
+
+	// The same link is usually found on many pages, so count each URL once
+	rc.mu.Lock()
+	seen := rc.excluded[parsedURL.String()]
+	rc.excluded[parsedURL.String()] = true
+	rc.mu.Unlock()
+	if rc.verbose && !seen {
+		fmt.Fprintf(rc.log, "Blocked by robots.txt: %s\n", parsedURL.String())
+	}
+	return false
+}
+
+// CrawlDelay returns the cached Crawl-delay for a host, or zero if unknown
+func (rc *RobotsCache) CrawlDelay(parsedURL *url.URL) time.Duration {
+	rules, ok := rc.CachedRules(parsedURL)
+	if !ok {
+		return 0
+	}
+	return rules.CrawlDelay
+}
+
+// Sitemaps returns the Sitemap URLs listed in a host's robots.txt
+func (rc *RobotsCache) Sitemaps(ctx context.Context, parsedURL *url.URL) []string {
+	return rc.Rules(ctx, parsedURL).Sitemaps
+}
+
+// ExcludedCount returns how many unique URLs were rejected because of robots.txt
+func (rc *RobotsCache) ExcludedCount() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.excluded)
+}
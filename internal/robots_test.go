@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMatchRobotsPattern(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/private", "/private/page", true},
+		{"/private", "/public", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/dir/index.php?x=1", true},
+		{"/*.php$", "/index.php", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/page$", "/page", true},
+		{"/page$", "/page/2", false},
+		{"/a*b*c", "/a-x-b-y-c", true},
+		{"/a*b*c", "/a-x-c-y-b", false},
+		{"*", "/", true},
+		{"/fish*", "/Fish", false}, // case-sensitive
+	}
+	for _, tt := range tests {
+		if got := matchRobotsPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchRobotsPattern(%q, %q) = %t, want %t", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	const body = `
+# comments are ignored
+User-agent: *
+Disallow: /private
+Allow: /private/open
+Disallow: /*.pdf$
+Crawl-delay: 5
+
+User-agent: gospider
+User-agent: otherbot
+Disallow: /tmp
+Allow: /page
+Disallow: /page
+Crawl-delay: 1.5
+
+User-agent: GoSpider
+Disallow: /also
+
+Sitemap: https://example.com/sitemap.xml
+`
+	tests := []struct {
+		agent, path string
+		want        bool
+	}{
+		// "*" group
+		{"somebot", "/", true},
+		{"somebot", "/private/x", false},
+		{"somebot", "/private/open/x", true}, // longer Allow wins
+		{"somebot", "/doc.pdf", false},
+		{"somebot", "/doc.pdf?x", true},
+		{"somebot", "/tmp", true},
+		// gospider's own groups replace "*" and are merged
+		{"gospider", "/private/x", true},
+		{"gospider", "/tmp/x", false},
+		{"gospider", "/also", false},
+		{"gospider", "/page", true}, // Allow wins a tie
+	}
+	for _, tt := range tests {
+		rules := ParseRobots([]byte(body), tt.agent)
+		if got := rules.Allowed(tt.path); got != tt.want {
+			t.Errorf("agent %s: Allowed(%q) = %t, want %t", tt.agent, tt.path, got, tt.want)
+		}
+	}
+
+	if got := ParseRobots([]byte(body), "somebot").CrawlDelay; got != 5*time.Second {
+		t.Errorf("somebot crawl-delay = %s, want 5s", got)
+	}
+	rules := ParseRobots([]byte(body), "gospider")
+	if rules.CrawlDelay != 1500*time.Millisecond {
+		t.Errorf("gospider crawl-delay = %s, want 1.5s", rules.CrawlDelay)
+	}
+	if len(rules.Sitemaps) != 1 || rules.Sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("sitemaps = %q", rules.Sitemaps)
+	}
+	if !ParseRobots([]byte("User-agent: *\nDisallow:\n"), "gospider").Allowed("/x") {
+		t.Error("empty Disallow blocked a path")
+	}
+}
+
+func TestCrawlDelayIsNotCapped(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"86400", 24 * time.Hour},
+		{"0.25", 250 * time.Millisecond},
+		{"1e300", time.Duration(math.MaxInt64)}, // too long for a Duration
+		{"-1", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		rules := ParseRobots([]byte("User-agent: *\nCrawl-delay: "+tt.value+"\n"), RobotsAgent)
+		if rules.CrawlDelay != tt.want {
+			t.Errorf("Crawl-delay: %s gave %s, want %s", tt.value, rules.CrawlDelay, tt.want)
+		}
+	}
+}
+
+// robotsServer serves robots.txt with the given status and body, counting requests
+func robotsServer(t *testing.T, status int, body string, hits *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		hits.Add(1)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRobotsCacheStatuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantPublic bool
+		wantSecret bool
+	}{
+		{"200 with rules", http.StatusOK, "User-agent: *\nDisallow: /secret\n", true, false},
+		{"404 allows everything", http.StatusNotFound, "", true, true},
+		{"403 allows everything", http.StatusForbidden, "", true, true},
+		{"503 disallows everything", http.StatusServiceUnavailable, "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			server := robotsServer(t, tt.status, tt.body, &hits)
+			cache := NewRobotsCache(server.Client(), RobotsAgent, false)
+
+			ctx := context.Background()
+			if got := cache.Allowed(ctx, server.URL+"/public"); got != tt.wantPublic {
+				t.Errorf("/public allowed = %t, want %t", got, tt.wantPublic)
+			}
+			if got := cache.Allowed(ctx, server.URL+"/secret"); got != tt.wantSecret {
+				t.Errorf("/secret allowed = %t, want %t", got, tt.wantSecret)
+			}
+			if hits.Load() != 1 {
+				t.Errorf("robots.txt fetched %d times, want once", hits.Load())
+			}
+		})
+	}
+}
+
+func TestRobotsCacheUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	origin := server.URL
+	server.Close()
+
+	cache := NewRobotsCache(&http.Client{Timeout: time.Second}, RobotsAgent, false)
+	if cache.Allowed(context.Background(), origin+"/page") {
+		t.Error("unreachable host was allowed")
+	}
+	parsedURL, _ := url.Parse(origin + "/page")
+	if _, ok := cache.CachedRules(parsedURL); !ok {
+		t.Error("unreachable result was not cached")
+	}
+	if cache.ExcludedCount() != 1 {
+		t.Errorf("excluded = %d, want 1", cache.ExcludedCount())
+	}
+}
+
+func TestRobotsCacheSkipsCancelledFetch(t *testing.T) {
+	var hits atomic.Int32
+	server := robotsServer(t, http.StatusOK, "User-agent: *\nDisallow: /secret\n", &hits)
+	cache := NewRobotsCache(server.Client(), RobotsAgent, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cache.Allowed(ctx, server.URL+"/public")
+	parsedURL, _ := url.Parse(server.URL + "/public")
+	if _, ok := cache.CachedRules(parsedURL); ok {
+		t.Fatal("result of a cancelled fetch was cached")
+	}
+
+	if !cache.Allowed(context.Background(), server.URL+"/public") {
+		t.Error("host disallowed after a cancelled fetch")
+	}
+	if cache.Allowed(context.Background(), server.URL+"/secret") {
+		t.Error("robots.txt rules not applied after a cancelled fetch")
+	}
+}
+
+func TestDequeueAppliesRobotsBeforeDispatch(t *testing.T) {
+	var hits atomic.Int32
+	server := robotsServer(t, http.StatusOK, "User-agent: *\nDisallow: /secret\n", &hits)
+	queue := NewQueue(10, 1, false)
+	queue.SetRobots(NewRobotsCache(server.Client(), RobotsAgent, false))
+	for _, path := range []string{"/secret/a", "/secret/b", "/public"} {
+		queue.Enqueue(server.URL + path)
+	}
+
+	// The host waits while its robots.txt is fetched in the background
+	ctx := context.Background()
+	if _, ok := queue.Dequeue(ctx); ok {
+		t.Fatal("dispatched a URL before robots.txt was known")
+	}
+	select {
+	case <-queue.Released():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no wake-up after robots.txt arrived")
+	}
+
+	// Disallowed URLs are dropped without using up the one-URL budget
+	entry, ok := queue.Dequeue(ctx)
+	if !ok || entry.URL != server.URL+"/public" {
+		t.Fatalf("dequeued %q, want /public", entry.URL)
+	}
+	if queue.ProcessedCount() != 1 || queue.InFlightCount() != 1 || queue.Len() != 0 {
+		t.Errorf("processed=%d inFlight=%d queued=%d, want only /public counted", queue.ProcessedCount(), queue.InFlightCount(), queue.Len())
+	}
+}
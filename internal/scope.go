@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"fmt"
+	"golang.org/x/net/publicsuffix"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Scope modes, deciding which hosts may be crawled relative to the seeds
+const (
+	ScopeHost   = "host"   // only the seeds' hosts
+	ScopeDomain = "domain" // the seeds' registrable domains, subdomains included
+	ScopeAny    = "any"    // any host, limited only by the domain count
+)
+
+// Scope decides whether a discovered URL belongs to the crawl. A URL is in scope when its
+// host passes the mode, it matches an allow pattern (if any are set), matches no deny
+// pattern, starts with an allowed path prefix (if any are set) and its extension is not denied.
+type Scope struct {
+	mode         string
+	allow        []*regexp.Regexp
+	deny         []*regexp.Regexp
+	pathPrefixes []string
+	denyExt      map[string]bool // lowercase, with the dot
+	seedHosts    map[string]bool
+	seedDomains  map[string]bool
+	seeds        map[string]bool   // seed URLs are always in scope
+	excluded     map[string]string // URL -> rule that excluded it
+	mu           sync.Mutex
+	verbose      bool
+	log          io.Writer // where verbose messages go, see SetLogOutput
+}
+
+// RuleCount is how many unique URLs one scope rule excluded
+type RuleCount struct {
+	Rule string
+	URLs int
+}
+
+// NewScope creates a scope; patterns are regular expressions matched against the full URL
+// and extensions may be given with or without the dot
+func NewScope(mode string, allow, deny, pathPrefixes, denyExtensions []string, verbose bool) (*Scope, error) {
+	switch mode {
+	case "":
+		mode = ScopeAny
+	case ScopeHost, ScopeDomain, ScopeAny:
+	default:
+		return nil, fmt.Errorf("unknown scope %q (want %s, %s or %s)", mode, ScopeHost, ScopeDomain, ScopeAny)
+	}
+
+	s := &Scope{
+		mode:        mode,
+		denyExt:     make(map[string]bool),
+		seedHosts:   make(map[string]bool),
+		seedDomains: make(map[string]bool),
+		seeds:       make(map[string]bool),
+		excluded:    make(map[string]string),
+		verbose:     verbose,
+		log:         os.Stdout,
+	}
+	for _, pattern := range allow {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow pattern %q: %v", pattern, err)
+		}
+		s.allow = append(s.allow, re)
+	}
+	for _, pattern := range deny {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %v", pattern, err)
+		}
+		s.deny = append(s.deny, re)
+	}
+	for _, prefix := range pathPrefixes {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			if !strings.HasPrefix(prefix, "/") {
+				prefix = "/" + prefix
+			}
+			s.pathPrefixes = append(s.pathPrefixes, prefix)
+		}
+	}
+	for _, ext := range denyExtensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		s.denyExt[ext] = true
+	}
+	return s, nil
+}
+
+// SetLogOutput sends verbose messages to w instead of stdout
+func (s *Scope) SetLogOutput(w io.Writer) {
+	s.log = w
+}
+
+// AddSeed lets the seed's host (or registrable domain) into the crawl. The seed itself is
+// always in scope, even if it misses the allow patterns or path prefixes.
+func (s *Scope) AddSeed(urlStr string) {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil || parsedURL.Host == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seeds[urlStr] = true
+	host := strings.ToLower(parsedURL.Hostname())
+	s.seedHosts[host] = true
+	s.seedDomains[registrableDomain(host)] = true
+}
+
+// Allowed reports whether urlStr is in scope, counting the rule that excluded it if not
+func (s *Scope) Allowed(urlStr string) bool {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	seed := s.seeds[urlStr]
+	s.mu.Unlock()
+	if seed {
+		return true
+	}
+	rule := s.check(urlStr, parsedURL)
+	if rule == "" {
+		return true
+	}
+
+	// The same link is usually found on many pages, so count each URL once
+	s.mu.Lock()
+	_, seen := s.excluded[urlStr]
+	if !seen {
+		s.excluded[urlStr] = rule
+	}
+	s.mu.Unlock()
+	if s.verbose && !seen {
+		fmt.Fprintf(s.log, "Out of scope (%s): %s\n", rule, urlStr)
+	}
+	return false
+}
+
+// check returns the first rule urlStr breaks, or "" when it is in scope
+func (s *Scope) check(urlStr string, parsedURL *url.URL) string {
+	if rule := s.hostRule(strings.ToLower(parsedURL.Hostname())); rule != "" {
+		return rule
+	}
+	if len(s.allow) > 0 && !matchesAny(s.allow, urlStr) {
+		return "no allow match"
+	}
+	for _, re := range s.deny {
+		if re.MatchString(urlStr) {
+			return "deny " + re.String()
+		}
+	}
+	if len(s.pathPrefixes) > 0 {
+		urlPath := parsedURL.EscapedPath()
+		if urlPath == "" {
+			urlPath = "/"
+		}
+		inPrefix := false
+		for _, prefix := range s.pathPrefixes {
+			if strings.HasPrefix(urlPath, prefix) {
+				inPrefix = true
+				break
+			}
+		}
+		if !inPrefix {
+			return "outside path prefixes"
+		}
+	}
+	if ext := strings.ToLower(path.Ext(parsedURL.Path)); s.denyExt[ext] {
+		return "extension " + ext
+	}
+	return ""
+}
+
+// hostRule returns the mode rule a host breaks, or ""
+func (s *Scope) hostRule(host string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.mode == ScopeHost && !s.seedHosts[host]:
+		return "scope=host"
+	case s.mode == ScopeDomain && !s.seedDomains[registrableDomain(host)]:
+		return "scope=domain"
+	}
+	return ""
+}
+
+// Excluded returns how many unique URLs each rule excluded, most first
+func (s *Scope) Excluded() []RuleCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byRule := make(map[string]int)
+	for _, rule := range s.excluded {
+		byRule[rule]++
+	}
+	counts := make([]RuleCount, 0, len(byRule))
+	for rule, n := range byRule {
+		counts = append(counts, RuleCount{Rule: rule, URLs: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].URLs != counts[j].URLs {
+			return counts[i].URLs > counts[j].URLs
+		}
+		return counts[i].Rule < counts[j].Rule
+	})
+	return counts
+}
+
+// registrableDomain returns the public suffix plus one label ("docs.example.co.uk" ->
+// "example.co.uk"), or the host itself for IPs, localhost and bare suffixes
+func registrableDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// matchesAny reports whether any pattern matches s
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSeedRedirectJoinsHostScope(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	// localhost is a different host from the 127.0.0.1 the seed uses
+	other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Host, "localhost") {
+			http.Redirect(w, r, other+r.URL.Path, http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<html><body><a href="/next">next</a></body></html>`)
+	})
+
+	scope, err := NewScope(ScopeHost, nil, nil, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := NewQueue(10, 0, false)
+	queue.SetScope(scope)
+	queue.AddSeed(server.URL + "/start")
+	sink := &collectSink{}
+	fetchOnce(t, queue, testFetchOptions(sink), server.URL+"/start")
+
+	if len(sink.pages) != 1 || sink.pages[0].FinalURL != other+"/start" {
+		t.Fatalf("got %d pages, want the seed followed to %s/start", len(sink.pages), other)
+	}
+	next, ok := queue.Dequeue(context.Background())
+	if !ok || next.URL != other+"/next" {
+		t.Errorf("next URL = %q, want the link on the redirect target", next.URL)
+	}
+
+	// A resumed crawl keeps the redirect target in scope
+	resumedScope, _ := NewScope(ScopeHost, nil, nil, nil, nil, false)
+	resumed := NewQueue(10, 0, false)
+	resumed.SetScope(resumedScope)
+	resumed.AddSeed(server.URL + "/start")
+	resumed.Restore(queue.Snapshot())
+	if !resumedScope.Allowed(other + "/elsewhere") {
+		t.Error("redirect target's host out of scope after resume")
+	}
+
+	// Redirects from pages that are not seeds still have to stay in scope
+	if err := queue.ClaimRedirect(other+"/next", "http://example.com/"); err == nil || err.Error() != "out of scope" {
+		t.Errorf("redirect off a non-seed page: err = %v, want out of scope", err)
+	}
+}
@@ -0,0 +1,363 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gospider/utils"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Page is the record handed to sinks for every processed page
+type Page struct {
+	URL        string                `json:"url"`
+	FinalURL   string                `json:"final_url"`
+	Redirects  []string              `json:"redirects,omitempty"` // full chain including URL and FinalURL
+	StatusCode int                   `json:"status"`
+	Headers    http.Header           `json:"headers"`
+	Title      string                `json:"title,omitempty"`
+	Meta       utils.PageMeta        `json:"meta"`
+	Markdown   string                `json:"markdown"`
+	Links      []utils.Link          `json:"links,omitempty"`
+	Records    []utils.Record        `json:"records,omitempty"`    // structured data from matching -rules
+	Structured *utils.StructuredData `json:"structured,omitempty"` // JSON-LD, microdata, OpenGraph and Twitter tags
+	FetchedAt  time.Time             `json:"fetched_at"`
+	Duration   time.Duration         `json:"duration_ns"`      // time from sending the request to reading the body
+	Depth      int                   `json:"depth"`            // links followed from a seed, 0 for seeds
+	Parent     string                `json:"parent,omitempty"` // page the URL was found on, "" for seeds
+
+	// Raw exchange for archival sinks, left out of JSON output
+	Request *http.Request `json:"-"` // final request sent, after redirects
+	Proto   string        `json:"-"` // response protocol, e.g. "HTTP/1.1"
+	Status  string        `json:"-"` // response status line text, e.g. "200 OK"
+	Body    []byte        `json:"-"` // response body as received, after transfer decoding
+}
+
+// Sink receives crawled pages. Write is called concurrently from every worker.
+type Sink interface {
+	Write(page *Page) error
+	Close() error
+}
+
+// FetchError describes a URL that could not be fetched or returned an error status
+type FetchError struct {
+	URL        string    `json:"url"`
+	StatusCode int       `json:"status,omitempty"` // 0 when no response was received
+	Class      string    `json:"class"`            // status class, e.g. "4xx" or "timeout"
+	Message    string    `json:"error"`
+	FetchedAt  time.Time `json:"fetched_at"`
+}
+
+// ErrorSink is implemented by sinks that also want to record failed fetches
+type ErrorSink interface {
+	WriteError(fetchErr *FetchError) error
+}
+
+// Exchange is one HTTP request and its response as they went over the wire. A fetch is one
+// exchange per redirect hop and retried attempt, whatever the status or content type.
+type Exchange struct {
+	Request    *http.Request // as sent, after request hooks
+	Proto      string        // response protocol, e.g. "HTTP/1.1"
+	Status     string        // response status line text, e.g. "301 Moved Permanently"
+	StatusCode int
+	Header     http.Header
+	Body       []byte // response body as received, after transfer decoding
+	Truncated  bool   // Body stops short: at the archive size limit or where the crawler stopped reading
+	FetchedAt  time.Time
+	Duration   time.Duration // time from sending the request to closing the body
+	Page       *Page         // the processed page when this is the fetch's last exchange, else nil
+}
+
+// ArchiveSink is implemented by sinks that record every exchange, not just processed pages.
+// Archive is called once the fetch is done, for each exchange in the order they happened.
+type ArchiveSink interface {
+	Archive(exchange *Exchange) error
+}
+
+// MarkdownSink writes each page as a .md file in a tree that mirrors the site's URLs
+type MarkdownSink struct {
+	paths       *OutputPaths
+	writer      *HighSpeedFileWriter
+	frontMatter bool
+	verbose     bool
+}
+
+// NewMarkdownSink creates a markdown tree under dir, optionally starting each file with YAML front matter
+func NewMarkdownSink(dir string, frontMatter bool, verbose bool) *MarkdownSink {
+	return &MarkdownSink{
+		paths:       NewOutputPaths(dir),
+		writer:      NewHighSpeedFileWriter(16), // 16 dedicated file writers for maximum speed
+		frontMatter: frontMatter,
+		verbose:     verbose,
+	}
+}
+
+// SetLogOutput sends verbose messages to w instead of stdout
+func (s *MarkdownSink) SetLogOutput(w io.Writer) {
+	s.writer.SetLogOutput(w)
+}
+
+// Write queues the page's markdown for writing, named after the page we landed on
+func (s *MarkdownSink) Write(page *Page) error {
+	filePath, err := s.paths.PathFor(page.FinalURL, ".md")
+	if filePath == "" {
+		return fmt.Errorf("error choosing output path for %s: %v", page.FinalURL, err)
+	}
+
+	markdown := page.Markdown
+	switch {
+	case s.frontMatter:
+		markdown = FrontMatter(page) + markdown
+	case len(page.Redirects) > 1:
+		markdown = redirectComment(page.Redirects) + markdown
+	}
+
+	// Use high-speed file writer for maximum throughput
+	s.writer.WriteFile(filePath, []byte(markdown), s.verbose)
+
+	// Structured data goes to a sidecar next to the markdown: page.md -> page.json
+	if !page.Structured.IsEmpty() {
+		sidecar, jsonErr := json.MarshalIndent(page.Structured, "", "  ")
+		if jsonErr != nil {
+			return jsonErr
+		}
+		s.writer.WriteFile(strings.TrimSuffix(filePath, ".md")+".json", sidecar, s.verbose)
+	}
+	return err
+}
+
+// Close waits for queued files and flushes the manifest
+func (s *MarkdownSink) Close() error {
+	s.writer.Close()
+	return s.paths.Close()
+}
+
+// redirectComment records a redirect chain at the top of a saved page
+func redirectComment(chain []string) string {
+	var sb strings.Builder
+	sb.WriteString("<!--\nredirects:\n")
+	for _, hop := range chain {
+		sb.WriteString("  - " + hop + "\n")
+	}
+	sb.WriteString("-->\n\n")
+	return sb.String()
+}
+
+// JSONLSink writes one JSON object per page to a file or stdout
+type JSONLSink struct {
+	writer *bufio.Writer
+	closer io.Closer // nil for stdout
+	mu     sync.Mutex
+}
+
+// NewJSONLSink writes JSON Lines to path, or to out when path is "-"
+func NewJSONLSink(path string, out io.Writer) (*JSONLSink, error) {
+	if path == "-" {
+		return &JSONLSink{writer: bufio.NewWriter(out)}, nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	return &JSONLSink{writer: bufio.NewWriterSize(file, 1048576), closer: file}, nil
+}
+
+// Write appends the page as one line of JSON
+func (s *JSONLSink) Write(page *Page) error {
+	return s.writeLine(page)
+}
+
+// writeLine appends any value as one line of JSON
+func (s *JSONLSink) writeLine(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writer.Write(line)
+	return s.writer.WriteByte('\n')
+}
+
+// Close flushes buffered records and closes the file
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.writer.Flush()
+	if s.closer != nil {
+		if closeErr := s.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// RecordsSink writes only the structured records extracted by -rules, one JSON line per record
+type RecordsSink struct {
+	lines *JSONLSink
+}
+
+// recordLine is one line of RecordsSink output
+type recordLine struct {
+	URL       string         `json:"url"`
+	Rule      string         `json:"rule"`
+	Data      map[string]any `json:"data"`
+	FetchedAt time.Time      `json:"fetched_at"`
+}
+
+// NewRecordsSink writes records to path, or to out when path is "-"
+func NewRecordsSink(path string, out io.Writer) (*RecordsSink, error) {
+	lines, err := NewJSONLSink(path, out)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsSink{lines: lines}, nil
+}
+
+// Write appends a line for each record on the page; pages without records are skipped
+func (s *RecordsSink) Write(page *Page) error {
+	for _, record := range page.Records {
+		err := s.lines.writeLine(recordLine{
+			URL:       page.FinalURL,
+			Rule:      record.Rule,
+			Data:      record.Data,
+			FetchedAt: page.FetchedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes buffered records and closes the file
+func (s *RecordsSink) Close() error {
+	return s.lines.Close()
+}
+
+// MultiSink fans every page out to several sinks
+type MultiSink []Sink
+
+// Write sends the page to every sink, even if some of them fail
+func (m MultiSink) Write(page *Page) error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Write(page); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteError passes the error to every sink that records errors
+func (m MultiSink) WriteError(fetchErr *FetchError) error {
+	var errs []error
+	for _, sink := range m {
+		if errorSink, ok := sink.(ErrorSink); ok {
+			if err := errorSink.WriteError(fetchErr); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Archive passes the exchange to every sink that archives exchanges
+func (m MultiSink) Archive(exchange *Exchange) error {
+	var errs []error
+	for _, sink := range m {
+		if archiver, ok := archiverOf(sink); ok {
+			if err := archiver.Archive(exchange); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every sink
+func (m MultiSink) Close() error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SinkOptions holds settings shared by the sinks NewSinkFromSpec can build
+type SinkOptions struct {
+	Stdout       io.Writer // where "jsonl:-" writes
+	WARCMaxBytes int64     // WARC file rotation size, 0 = never rotate
+	FrontMatter  bool      // start markdown files with YAML front matter
+	Log          io.Writer // where verbose messages go, nil = stdout
+	Verbose      bool
+}
+
+// NewSinkFromSpec builds a sink from an -output value of the form "kind[:target]":
+//
+//	markdown[:dir]   markdown tree, default dir "output"
+//	jsonl[:path]     JSON Lines, default "-" for stdout
+//	records[:path]   only the -rules records as JSON Lines, default "-" for stdout
+//	warc[:dir]       gzipped WARC 1.1 files, default dir "warc"
+//	sqlite[:path]    SQLite crawl database, default "crawl.db"
+func NewSinkFromSpec(spec string, opts SinkOptions) (Sink, error) {
+	kind, target, _ := strings.Cut(spec, ":")
+	switch strings.ToLower(kind) {
+	case "markdown", "md":
+		if target == "" {
+			target = "output"
+		}
+		sink := NewMarkdownSink(target, opts.FrontMatter, opts.Verbose)
+		if opts.Log != nil {
+			sink.SetLogOutput(opts.Log)
+		}
+		return sink, nil
+	case "jsonl", "json":
+		if target == "" {
+			target = "-"
+		}
+		return NewJSONLSink(target, opts.Stdout)
+	case "records":
+		if target == "" {
+			target = "-"
+		}
+		return NewRecordsSink(target, opts.Stdout)
+	case "warc":
+		if target == "" {
+			target = "warc"
+		}
+		sink, err := NewWARCSink(target, opts.WARCMaxBytes, opts.Verbose)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Log != nil {
+			sink.SetLogOutput(opts.Log)
+		}
+		return sink, nil
+	case "sqlite", "db":
+		if target == "" {
+			target = "crawl.db"
+		}
+		return NewSQLiteSink(target)
+	default:
+		return nil, fmt.Errorf("unknown output %q (want markdown[:dir], jsonl[:path], records[:path], warc[:dir] or sqlite[:path])", spec)
+	}
+}
+
+// WritesToStdout reports whether an -output value streams records to stdout
+func WritesToStdout(spec string) bool {
+	kind, target, _ := strings.Cut(spec, ":")
+	kind = strings.ToLower(kind)
+	return (kind == "jsonl" || kind == "json" || kind == "records") && (target == "" || target == "-")
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"gospider/utils"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure-Go driver, registers "sqlite"
+)
+
+// sqliteSchema is applied when the database is opened; existing tables are kept so crawls can append
+const sqliteSchema = `
+PRAGMA journal_mode = WAL;
+PRAGMA synchronous = NORMAL;
+
+CREATE TABLE IF NOT EXISTS pages (
+	url          TEXT PRIMARY KEY,
+	url_key      TEXT NOT NULL, -- normalized url, see links.target_key
+	final_url    TEXT NOT NULL,
+	domain       TEXT NOT NULL,
+	status       INTEGER NOT NULL,
+	title        TEXT,
+	content_type TEXT,
+	size         INTEGER NOT NULL,
+	fetched_at   TEXT NOT NULL,
+	duration_ms  INTEGER NOT NULL,
+	markdown     TEXT
+);
+CREATE INDEX IF NOT EXISTS pages_url_key ON pages(url_key);
+
+CREATE TABLE IF NOT EXISTS links (
+	source     TEXT NOT NULL,
+	target     TEXT NOT NULL,
+	target_key TEXT NOT NULL, -- normalized target, matches pages.url_key and errors.url_key
+	anchor     TEXT,
+	tag        TEXT NOT NULL,
+	rel        TEXT
+);
+CREATE INDEX IF NOT EXISTS links_source ON links(source);
+CREATE INDEX IF NOT EXISTS links_target_key ON links(target_key);
+
+CREATE TABLE IF NOT EXISTS assets (
+	page TEXT NOT NULL,
+	url  TEXT NOT NULL,
+	tag  TEXT NOT NULL,
+	alt  TEXT
+);
+CREATE INDEX IF NOT EXISTS assets_page ON assets(page);
+
+CREATE TABLE IF NOT EXISTS domains (
+	domain     TEXT PRIMARY KEY,
+	pages      INTEGER NOT NULL DEFAULT 0,
+	errors     INTEGER NOT NULL DEFAULT 0,
+	bytes      INTEGER NOT NULL DEFAULT 0,
+	first_seen TEXT NOT NULL,
+	last_seen  TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS errors (
+	url        TEXT NOT NULL,
+	url_key    TEXT NOT NULL, -- normalized url, see links.target_key
+	domain     TEXT NOT NULL,
+	status     INTEGER,
+	class      TEXT NOT NULL,
+	message    TEXT,
+	fetched_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS errors_url_key ON errors(url_key);
+`
+
+// SQLiteSink stores pages, links, assets, per-domain totals and fetch errors in one database
+type SQLiteSink struct {
+	db         *sql.DB
+	normalizer *utils.URLNormalizer
+}
+
+// OpenCrawlDB opens (or creates) a crawl database and makes sure the schema exists
+func OpenCrawlDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+
+	// SQLite allows one writer at a time, so serialise on a single connection
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema in %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// NewSQLiteSink writes crawl results to the database at path
+func NewSQLiteSink(path string) (*SQLiteSink, error) {
+	db, err := OpenCrawlDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteSink{
+		db:         db,
+		normalizer: utils.NewURLNormalizer(utils.DefaultTrackingParams),
+	}, nil
+}
+
+// Write stores a page with its links and assets in one transaction
+func (s *SQLiteSink) Write(page *Page) error {
+	domain, _ := utils.ExtractDomain(page.URL, false)
+	fetchedAt := page.FetchedAt.UTC().Format(time.RFC3339)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// A page crawled again (e.g. after a resume) replaces its earlier row and links
+	_, err = tx.Exec(`INSERT OR REPLACE INTO pages
+		(url, url_key, final_url, domain, status, title, content_type, size, fetched_at, duration_ms, markdown)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		page.URL, s.key(page.URL), page.FinalURL, domain, page.StatusCode, page.Title, page.Headers.Get("Content-Type"),
+		len(page.Body), fetchedAt, page.Duration.Milliseconds(), page.Markdown)
+	if err != nil {
+		return fmt.Errorf("failed to store page %s: %v", page.URL, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM links WHERE source = ?`, page.URL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM assets WHERE page = ?`, page.URL); err != nil {
+		return err
+	}
+
+	for _, link := range page.Links {
+		if link.Kind == utils.LinkAsset {
+			_, err = tx.Exec(`INSERT INTO assets (page, url, tag, alt) VALUES (?, ?, ?, ?)`,
+				page.URL, link.URL, link.Tag, link.Text)
+		} else {
+			_, err = tx.Exec(`INSERT INTO links (source, target, target_key, anchor, tag, rel) VALUES (?, ?, ?, ?, ?, ?)`,
+				page.URL, link.URL, s.key(link.URL), link.Text, link.Tag, strings.Join(link.Rel, " "))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to store links for %s: %v", page.URL, err)
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO domains (domain, pages, bytes, first_seen, last_seen) VALUES (?, 1, ?, ?, ?)
+		ON CONFLICT(domain) DO UPDATE SET pages = pages + 1, bytes = bytes + excluded.bytes, last_seen = excluded.last_seen`,
+		domain, len(page.Body), fetchedAt, fetchedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update domain %s: %v", domain, err)
+	}
+
+	return tx.Commit()
+}
+
+// WriteError records a failed fetch and counts it against its domain
+func (s *SQLiteSink) WriteError(fetchErr *FetchError) error {
+	domain, _ := utils.ExtractDomain(fetchErr.URL, false)
+	fetchedAt := fetchErr.FetchedAt.UTC().Format(time.RFC3339)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO errors (url, url_key, domain, status, class, message, fetched_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		fetchErr.URL, s.key(fetchErr.URL), domain, fetchErr.StatusCode, fetchErr.Class, fetchErr.Message, fetchedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store error for %s: %v", fetchErr.URL, err)
+	}
+	_, err = tx.Exec(`INSERT INTO domains (domain, errors, first_seen, last_seen) VALUES (?, 1, ?, ?)
+		ON CONFLICT(domain) DO UPDATE SET errors = errors + 1, last_seen = excluded.last_seen`,
+		domain, fetchedAt, fetchedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update domain %s: %v", domain, err)
+	}
+
+	return tx.Commit()
+}
+
+// key returns the normalized form of a URL that links, pages and errors are joined on
+func (s *SQLiteSink) key(urlStr string) string {
+	key, err := s.normalizer.Normalize(urlStr)
+	if err != nil {
+		return urlStr
+	}
+	return key
+}
+
+// Close closes the database
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
+
+// Report is a canned query for `gospider query`
+type Report struct {
+	Name        string
+	Description string
+	SQL         string // takes one parameter: the row limit
+}
+
+// Reports are the queries `gospider query` can run against a crawl database
+var Reports = []Report{
+	{
+		Name:        "domains",
+		Description: "Domains with the most pages crawled",
+		SQL: `SELECT domain, pages, errors, bytes, last_seen
+			FROM domains ORDER BY pages DESC, errors DESC LIMIT ?`,
+	},
+	{
+		Name:        "broken",
+		Description: "Links to URLs that failed or returned an error status",
+		SQL: `SELECT l.source, l.target, l.anchor, e.status, e.class
+			FROM links l JOIN (SELECT url_key, MAX(status) AS status, class FROM errors GROUP BY url_key) e ON e.url_key = l.target_key
+			ORDER BY e.status DESC, l.source LIMIT ?`,
+	},
+	{
+		Name:        "largest",
+		Description: "Largest pages by body size",
+		SQL: `SELECT url, size, status, content_type, title
+			FROM pages ORDER BY size DESC LIMIT ?`,
+	},
+}
+
+// FindReport looks up a report by name
+func FindReport(name string) (Report, bool) {
+	for _, report := range Reports {
+		if report.Name == name {
+			return report, true
+		}
+	}
+	return Report{}, false
+}
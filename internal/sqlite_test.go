@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"gospider/utils"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestBrokenReportMatchesNormalizedURLs(t *testing.T) {
+	sink, err := NewSQLiteSink(filepath.Join(t.TempDir(), "crawl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	page := &Page{
+		URL:       "https://example.com/",
+		FinalURL:  "https://example.com/",
+		Headers:   http.Header{},
+		FetchedAt: time.Now(),
+		Links: []utils.Link{
+			{URL: "https://example.com/gone/", Kind: utils.LinkNavigation, Tag: "a"},
+			{URL: "https://example.com/about#team", Kind: utils.LinkNavigation, Tag: "a"},
+			{URL: "https://example.com/fine", Kind: utils.LinkNavigation, Tag: "a"},
+		},
+	}
+	if err := sink.Write(page); err != nil {
+		t.Fatal(err)
+	}
+	// Errors are recorded under the URL as it was fetched
+	for _, urlStr := range []string{"https://example.com/gone/", "https://example.com/about"} {
+		fetchErr := &FetchError{URL: urlStr, StatusCode: http.StatusNotFound, Class: Status4xx.String(), Message: "404 Not Found", FetchedAt: time.Now()}
+		if err := sink.WriteError(fetchErr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, _ := FindReport("broken")
+	rows, err := sink.db.Query(report.SQL, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var targets []string
+	for rows.Next() {
+		var source, target, anchor, class string
+		var status int
+		if err := rows.Scan(&source, &target, &anchor, &status, &class); err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	if len(targets) != 2 || targets[0] != "https://example.com/about#team" || targets[1] != "https://example.com/gone/" {
+		t.Errorf("broken links = %q, want the /gone/ and /about#team links", targets)
+	}
+}
@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// StatusClass groups fetch outcomes for reporting
+type StatusClass int
+
+const (
+	Status2xx StatusClass = iota
+	Status3xx
+	Status4xx
+	Status5xx
+	StatusError   // transport error: DNS, connection refused, TLS, reset...
+	StatusTimeout // the request or the connection timed out
+)
+
+// StatusClasses lists every class in display order
+var StatusClasses = []StatusClass{Status2xx, Status3xx, Status4xx, Status5xx, StatusError, StatusTimeout}
+
+func (c StatusClass) String() string {
+	switch c {
+	case Status2xx:
+		return "2xx"
+	case Status3xx:
+		return "3xx"
+	case Status4xx:
+		return "4xx"
+	case Status5xx:
+		return "5xx"
+	case StatusTimeout:
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+// ClassifyResponse puts the outcome of a request into a StatusClass
+func ClassifyResponse(response *http.Response, err error) StatusClass {
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return StatusTimeout
+		}
+		return StatusError
+	}
+
+	switch {
+	case response.StatusCode >= 500:
+		return Status5xx
+	case response.StatusCode >= 400:
+		return Status4xx
+	case response.StatusCode >= 300:
+		return Status3xx
+	case response.StatusCode >= 200:
+		return Status2xx
+	default:
+		return StatusError
+	}
+}
+
+// StatusCounts maps a status class name (see StatusClass.String) to a count
+type StatusCounts map[string]int
+
+// DomainStatus is the per-status breakdown for one domain
+type DomainStatus struct {
+	Domain string
+	Total  int
+	Counts StatusCounts
+}
+
+// CrawlStats counts fetch outcomes per status class and per domain, pages per schema type
+// and fetches per crawl depth
+type CrawlStats struct {
+	byClass     StatusCounts
+	byDomain    map[string]StatusCounts
+	schemaTypes map[string]int
+	depths      map[int]int
+	mu          sync.Mutex
+}
+
+// TypeCount is the number of pages carrying one structured data type
+type TypeCount struct {
+	Type  string
+	Pages int
+}
+
+// DepthCount is the number of URLs fetched at one depth
+type DepthCount struct {
+	Depth int
+	URLs  int
+}
+
+// NewCrawlStats creates empty statistics
+func NewCrawlStats() *CrawlStats {
+	return &CrawlStats{
+		byClass:     make(StatusCounts),
+		byDomain:    make(map[string]StatusCounts),
+		schemaTypes: make(map[string]int),
+		depths:      make(map[int]int),
+	}
+}
+
+// RecordDepth counts one fetch at a depth
+func (s *CrawlStats) RecordDepth(depth int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.depths[depth]++
+}
+
+// ByDepth returns fetch counts per depth, shallowest first
+func (s *CrawlStats) ByDepth() []DepthCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	depths := make([]DepthCount, 0, len(s.depths))
+	for depth, n := range s.depths {
+		depths = append(depths, DepthCount{Depth: depth, URLs: n})
+	}
+	sort.Slice(depths, func(i, j int) bool { return depths[i].Depth < depths[j].Depth })
+	return depths
+}
+
+// snapshotDepths copies the per-depth counts for checkpoints
+func (s *CrawlStats) snapshotDepths() map[int]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	depths := make(map[int]int, len(s.depths))
+	for depth, n := range s.depths {
+		depths[depth] = n
+	}
+	return depths
+}
+
+// restoreDepths replaces the per-depth counts with those saved in a checkpoint
+func (s *CrawlStats) restoreDepths(depths map[int]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.depths = make(map[int]int, len(depths))
+	for depth, n := range depths {
+		s.depths[depth] = n
+	}
+}
+
+// RecordSchemaTypes counts one page for each structured data type it carries
+func (s *CrawlStats) RecordSchemaTypes(types []string) {
+	if len(types) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range types {
+		s.schemaTypes[t]++
+	}
+}
+
+// SchemaTypes returns page counts per structured data type, most common first
+func (s *CrawlStats) SchemaTypes() []TypeCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	types := make([]TypeCount, 0, len(s.schemaTypes))
+	for t, n := range s.schemaTypes {
+		types = append(types, TypeCount{Type: t, Pages: n})
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].Pages != types[j].Pages {
+			return types[i].Pages > types[j].Pages
+		}
+		return types[i].Type < types[j].Type
+	})
+	return types
+}
+
+// snapshotSchemaTypes copies the schema type counts for checkpoints
+func (s *CrawlStats) snapshotSchemaTypes() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	types := make(map[string]int, len(s.schemaTypes))
+	for t, n := range s.schemaTypes {
+		types[t] = n
+	}
+	return types
+}
+
+// restoreSchemaTypes replaces the schema type counts with those saved in a checkpoint
+func (s *CrawlStats) restoreSchemaTypes(types map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schemaTypes = make(map[string]int, len(types))
+	for t, n := range types {
+		s.schemaTypes[t] = n
+	}
+}
+
+// Record counts one fetch outcome for a domain
+func (s *CrawlStats) Record(domain string, class StatusClass) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.byClass[class.String()]++
+	counts, ok := s.byDomain[domain]
+	if !ok {
+		counts = make(StatusCounts)
+		s.byDomain[domain] = counts
+	}
+	counts[class.String()]++
+}
+
+// ByClass returns a copy of the totals per status class
+func (s *CrawlStats) ByClass() StatusCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(StatusCounts, len(s.byClass))
+	for class, n := range s.byClass {
+		counts[class] = n
+	}
+	return counts
+}
+
+// ByDomain returns per-domain breakdowns sorted by number of fetches, busiest first
+func (s *CrawlStats) ByDomain() []DomainStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domains := make([]DomainStatus, 0, len(s.byDomain))
+	for domain, counts := range s.byDomain {
+		entry := DomainStatus{Domain: domain, Counts: make(StatusCounts, len(counts))}
+		for class, n := range counts {
+			entry.Counts[class] = n
+			entry.Total += n
+		}
+		domains = append(domains, entry)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].Total != domains[j].Total {
+			return domains[i].Total > domains[j].Total
+		}
+		return domains[i].Domain < domains[j].Domain
+	})
+	return domains
+}
+
+// snapshot returns a deep copy of the per-domain counts for checkpoints
+func (s *CrawlStats) snapshot() map[string]StatusCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byDomain := make(map[string]StatusCounts, len(s.byDomain))
+	for domain, counts := range s.byDomain {
+		copied := make(StatusCounts, len(counts))
+		for class, n := range counts {
+			copied[class] = n
+		}
+		byDomain[domain] = copied
+	}
+	return byDomain
+}
+
+// restore replaces the counts with those saved in a checkpoint
+func (s *CrawlStats) restore(byDomain map[string]StatusCounts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.byClass = make(StatusCounts)
+	s.byDomain = make(map[string]StatusCounts, len(byDomain))
+	for domain, counts := range byDomain {
+		copied := make(StatusCounts, len(counts))
+		for class, n := range counts {
+			copied[class] = n
+			s.byClass[class] += n
+		}
+		s.byDomain[domain] = copied
+	}
+}
@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaTypeCounts(t *testing.T) {
+	stats := NewCrawlStats()
+	stats.RecordSchemaTypes([]string{"Product", "og:product"})
+	stats.RecordSchemaTypes([]string{"Product"})
+	stats.RecordSchemaTypes([]string{"Article"})
+	stats.RecordSchemaTypes(nil)
+
+	want := []TypeCount{{Type: "Product", Pages: 2}, {Type: "Article", Pages: 1}, {Type: "og:product", Pages: 1}}
+	if got := stats.SchemaTypes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SchemaTypes() = %v, want %v", got, want)
+	}
+
+	// The counts survive a checkpoint round trip
+	restored := NewCrawlStats()
+	restored.restoreSchemaTypes(stats.snapshotSchemaTypes())
+	if got := restored.SchemaTypes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored SchemaTypes() = %v, want %v", got, want)
+	}
+}
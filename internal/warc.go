@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"gospider/utils"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWARCMaxBytes is the size at which a WARC file is closed and a new one started
+const DefaultWARCMaxBytes = 1024 * 1024 * 1024
+
+// WARCSink writes every exchange as gzip-per-record WARC 1.1 request and response records, with
+// a metadata record for each processed page
+type WARCSink struct {
+	dir      string
+	prefix   string
+	maxBytes int64
+	serial   int
+	file     *os.File
+	path     string
+	written  int64
+	verbose  bool
+	log      io.Writer // where verbose messages go, see SetLogOutput
+	mu       sync.Mutex
+}
+
+// NewWARCSink creates a WARC writer in dir, starting a new file once maxBytes is reached
+func NewWARCSink(dir string, maxBytes int64, verbose bool) (*WARCSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create WARC dir: %v", err)
+	}
+	return &WARCSink{
+		dir:      dir,
+		prefix:   "gospider-" + time.Now().UTC().Format("20060102150405"),
+		maxBytes: maxBytes,
+		verbose:  verbose,
+		log:      os.Stdout,
+	}, nil
+}
+
+// SetLogOutput sends verbose messages to w instead of stdout
+func (s *WARCSink) SetLogOutput(w io.Writer) {
+	s.log = w
+}
+
+// Write does nothing: every page also reaches the sink with its last exchange through Archive
+func (s *WARCSink) Write(page *Page) error {
+	return nil
+}
+
+// Archive appends the exchange's request and response records, plus a metadata record
+// (redirect chain and outlinks) when it carries a processed page
+func (s *WARCSink) Archive(exchange *Exchange) error {
+	req := exchange.Request
+	target := req.URL.String()
+	date := exchange.FetchedAt.UTC().Format(time.RFC3339)
+	responseID := newRecordID()
+
+	// The response block is the raw status line and headers followed by the body
+	var response bytes.Buffer
+	fmt.Fprintf(&response, "%s %s\r\n", exchange.Proto, exchange.Status)
+	writeHeaders(&response, exchange.Header)
+	response.WriteString("\r\n")
+	response.Write(exchange.Body)
+
+	responseHeaders := []warcHeader{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", target},
+		{"Content-Type", "application/http;msgtype=response"},
+		{"WARC-Payload-Digest", sha1Digest(exchange.Body)},
+		{"WARC-Block-Digest", sha1Digest(response.Bytes())},
+	}
+	if exchange.Truncated {
+		responseHeaders = append(responseHeaders, warcHeader{"WARC-Truncated", "length"})
+	}
+
+	// The request as it went over the wire for this hop
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "%s %s %s\r\n", req.Method, req.URL.RequestURI(), "HTTP/1.1")
+	requestHeaders := req.Header.Clone()
+	requestHeaders.Set("Host", req.Host)
+	if req.Host == "" {
+		requestHeaders.Set("Host", req.URL.Host)
+	}
+	writeHeaders(&request, requestHeaders)
+	request.WriteString("\r\n")
+
+	requestRecordHeaders := []warcHeader{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", target},
+		{"WARC-Concurrent-To", responseID},
+		{"Content-Type", "application/http;msgtype=request"},
+		{"WARC-Block-Digest", sha1Digest(request.Bytes())},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rotate(); err != nil {
+		return err
+	}
+	if err := s.writeRecord(requestRecordHeaders, request.Bytes()); err != nil {
+		return err
+	}
+	if err := s.writeRecord(responseHeaders, response.Bytes()); err != nil {
+		return err
+	}
+	if exchange.Page == nil {
+		return nil
+	}
+
+	metadata := pageMetadata(exchange.Page)
+	return s.writeRecord([]warcHeader{
+		{"WARC-Type", "metadata"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", target},
+		{"WARC-Concurrent-To", responseID},
+		{"Content-Type", "application/warc-fields"},
+		{"WARC-Block-Digest", sha1Digest(metadata)},
+	}, metadata)
+}
+
+// pageMetadata lists outlinks in the Heritrix style: "outlink: <url> <L|E> <tag>"
+func pageMetadata(page *Page) []byte {
+	var metadata bytes.Buffer
+	if len(page.Redirects) > 1 {
+		for _, hop := range page.Redirects[:len(page.Redirects)-1] {
+			fmt.Fprintf(&metadata, "redirect: %s\r\n", hop)
+		}
+	}
+	if page.Parent != "" {
+		fmt.Fprintf(&metadata, "via: %s\r\n", page.Parent)
+	}
+	fmt.Fprintf(&metadata, "depth: %d\r\n", page.Depth)
+	fmt.Fprintf(&metadata, "fetchTimeMs: %d\r\n", page.Duration.Milliseconds())
+	for _, link := range page.Links {
+		hopType := "L"
+		if link.Kind == utils.LinkAsset {
+			hopType = "E"
+		}
+		fmt.Fprintf(&metadata, "outlink: %s %s %s\r\n", link.URL, hopType, link.Tag)
+	}
+	return metadata.Bytes()
+}
+
+// rotate opens the first file, or starts a new one when the current file is full
+func (s *WARCSink) rotate() error {
+	if s.file != nil && (s.maxBytes <= 0 || s.written < s.maxBytes) {
+		return nil
+	}
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+
+	// Files are written under a .open suffix and renamed once complete
+	s.serial++
+	name := fmt.Sprintf("%s-%05d.warc.gz", s.prefix, s.serial)
+	s.path = filepath.Join(s.dir, name)
+	file, err := os.Create(s.path + ".open")
+	if err != nil {
+		return fmt.Errorf("failed to create WARC file: %v", err)
+	}
+	s.file = file
+	s.written = 0
+
+	info := fmt.Sprintf("software: gospider\r\nformat: WARC File Format 1.1\r\nconformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\nhttp-header-user-agent: %s\r\n", UserAgent)
+	return s.writeRecord([]warcHeader{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", time.Now().UTC().Format(time.RFC3339)},
+		{"WARC-Filename", name},
+		{"Content-Type", "application/warc-fields"},
+	}, []byte(info))
+}
+
+// writeRecord writes one record as its own gzip member
+func (s *WARCSink) writeRecord(headers []warcHeader, block []byte) error {
+	counter := &countingWriter{w: s.file}
+	gz := gzip.NewWriter(counter)
+
+	var head bytes.Buffer
+	head.WriteString("WARC/1.1\r\n")
+	for _, h := range headers {
+		fmt.Fprintf(&head, "%s: %s\r\n", h.name, h.value)
+	}
+	fmt.Fprintf(&head, "Content-Length: %d\r\n\r\n", len(block))
+
+	gz.Write(head.Bytes())
+	gz.Write(block)
+	gz.Write([]byte("\r\n\r\n"))
+	err := gz.Close()
+	s.written += counter.n
+	if err != nil {
+		return fmt.Errorf("failed to write WARC record: %v", err)
+	}
+	return nil
+}
+
+// closeFile finishes the current file and drops the .open suffix
+func (s *WARCSink) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close WARC file: %v", err)
+	}
+	if err := os.Rename(s.path+".open", s.path); err != nil {
+		return fmt.Errorf("failed to finalize WARC file: %v", err)
+	}
+	if s.verbose {
+		fmt.Fprintf(s.log, "WARC file complete: %s\n", s.path)
+	}
+	return nil
+}
+
+// Close finishes the current WARC file
+func (s *WARCSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeFile()
+}
+
+// warcHeader keeps record headers in a fixed order
+type warcHeader struct {
+	name  string
+	value string
+}
+
+// countingWriter counts compressed bytes for rotation
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeHeaders writes HTTP headers in a stable order
+func writeHeaders(buf *bytes.Buffer, headers http.Header) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range headers[name] {
+			fmt.Fprintf(buf, "%s: %s\r\n", name, strings.ReplaceAll(value, "\r\n", " "))
+		}
+	}
+}
+
+// sha1Digest formats a digest the way WARC expects: sha1:<base32>
+func sha1Digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// newRecordID returns a random urn:uuid record ID
+func newRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,229 @@
+package internal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"gospider/utils"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// warcRecord is one parsed record of a WARC file
+type warcRecord struct {
+	headers map[string]string
+	block   string
+}
+
+// readWARC parses every record of the finished WARC files in dir
+func readWARC(t *testing.T, dir string) []warcRecord {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("WARC files = %q, %v; want one", paths, err)
+	}
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(gz)
+
+	var records []warcRecord
+	for {
+		version, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return records
+		}
+		if err != nil || version != "WARC/1.1\r\n" {
+			t.Fatalf("bad record start %q: %v", version, err)
+		}
+		record := warcRecord{headers: make(map[string]string)}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\r\n" {
+				break
+			}
+			name, value, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ": ")
+			record.headers[name] = value
+		}
+		length, _ := strconv.Atoi(record.headers["Content-Length"])
+		block := make([]byte, length+4)
+		if _, err := io.ReadFull(reader, block); err != nil {
+			t.Fatal(err)
+		}
+		record.block = string(block[:length])
+		records = append(records, record)
+	}
+}
+
+func TestWARCArchivesEveryExchange(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<html><body><a href="/missing">m</a></body></html>`)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone fishing", http.StatusNotFound)
+	})
+	mux.HandleFunc("/pic.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, "\x89PNG-bytes")
+	})
+	mux.HandleFunc("/file.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(w, "%PDF-1.7 body")
+	})
+	mux.HandleFunc("/big.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, strings.Repeat("x", 4000))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir := t.TempDir()
+	warc, err := NewWARCSink(dir, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := &collectSink{}
+	opts := testFetchOptions(MultiSink{pages, warc})
+	opts.MaxHTMLBytes = 1024
+	opts.MaxImageBytes = 512
+	opts.DownloadImages = true
+	opts.Images = utils.NewImageStore(t.TempDir())
+
+	queue := NewQueue(10, 0, false)
+	for _, path := range []string{"/start", "/missing", "/pic.png", "/file.pdf", "/big.html"} {
+		fetchOnce(t, queue, opts, server.URL+path)
+	}
+	if err := warc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(pages.pages) != 1 {
+		t.Errorf("page sink got %d pages, want only /page", len(pages.pages))
+	}
+
+	responses := make(map[string]warcRecord)
+	requests := make(map[string]bool)
+	var metadata []warcRecord
+	for _, record := range readWARC(t, dir) {
+		path := strings.TrimPrefix(record.headers["WARC-Target-URI"], server.URL)
+		switch record.headers["WARC-Type"] {
+		case "response":
+			responses[path] = record
+		case "request":
+			requests[path] = true
+		case "metadata":
+			metadata = append(metadata, record)
+		}
+	}
+
+	want := map[string]string{
+		"/start":    "HTTP/1.1 301 Moved Permanently",
+		"/page":     "HTTP/1.1 200 OK",
+		"/missing":  "HTTP/1.1 404 Not Found",
+		"/pic.png":  "HTTP/1.1 200 OK",
+		"/file.pdf": "HTTP/1.1 200 OK",
+		"/big.html": "HTTP/1.1 200 OK",
+	}
+	for path, statusLine := range want {
+		record, ok := responses[path]
+		if !ok {
+			t.Errorf("no response record for %s", path)
+			continue
+		}
+		if !strings.HasPrefix(record.block, statusLine+"\r\n") {
+			t.Errorf("%s response starts %q, want %q", path, strings.SplitN(record.block, "\r\n", 2)[0], statusLine)
+		}
+		if !requests[path] {
+			t.Errorf("no request record for %s", path)
+		}
+	}
+	if len(responses) != len(want) {
+		t.Errorf("got %d response records, want %d", len(responses), len(want))
+	}
+
+	// Bodies the crawler read are archived whole; skipped ones are not downloaded for the archive
+	if record := responses["/pic.png"]; !strings.HasSuffix(record.block, "\r\n\r\n\x89PNG-bytes") || record.headers["WARC-Truncated"] != "" {
+		t.Error("/pic.png response body not archived")
+	}
+	for _, path := range []string{"/missing", "/file.pdf"} {
+		if record := responses[path]; !strings.HasSuffix(record.block, "\r\n\r\n") || record.headers["WARC-Truncated"] != "length" {
+			t.Errorf("%s: WARC-Truncated=%q, want the unread body left out and marked truncated", path, record.headers["WARC-Truncated"])
+		}
+	}
+	big := responses["/big.html"]
+	if big.headers["WARC-Truncated"] != "length" || !strings.HasSuffix(big.block, "\r\n\r\n"+strings.Repeat("x", 1024)) {
+		t.Errorf("/big.html: WARC-Truncated=%q, want the body cut at 1024 bytes", big.headers["WARC-Truncated"])
+	}
+	for _, path := range []string{"/start", "/page"} {
+		if _, ok := responses[path].headers["WARC-Truncated"]; ok {
+			t.Errorf("%s response marked truncated", path)
+		}
+	}
+
+	if len(metadata) != 1 || metadata[0].headers["WARC-Target-URI"] != server.URL+"/page" {
+		t.Fatalf("got %d metadata records, want one for /page", len(metadata))
+	}
+	if block := metadata[0].block; !strings.Contains(block, "redirect: "+server.URL+"/start\r\n") || !strings.Contains(block, "outlink: "+server.URL+"/missing L a\r\n") {
+		t.Errorf("metadata = %q, want the redirect and the outlink", block)
+	}
+}
+
+// countingReader is an endless body that counts the bytes taken from it
+type countingReader struct{ n int64 }
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.n += int64(len(p))
+	return len(p), nil
+}
+
+func (r *countingReader) Close() error { return nil }
+
+func TestRecordingBodyDoesNotDrainUnreadBody(t *testing.T) {
+	source := &countingReader{}
+	exchange := &Exchange{}
+	body := &recordingBody{ReadCloser: source, exchange: exchange, limit: archiveLimit(&FetchOptions{})}
+	io.ReadFull(body, make([]byte, 100))
+	body.Close()
+
+	if source.n != 100 {
+		t.Errorf("read %d bytes of the body, want only the 100 the crawler asked for", source.n)
+	}
+	if !exchange.Truncated || len(exchange.Body) != 100 {
+		t.Errorf("truncated=%t with %d bytes, want the 100 read bytes marked truncated", exchange.Truncated, len(exchange.Body))
+	}
+}
+
+func TestArchiveLimitIsAlwaysCapped(t *testing.T) {
+	tests := []struct {
+		html, image, want int64
+	}{
+		{0, 0, maxArchiveBytes},
+		{0, 512, maxArchiveBytes},
+		{1024, 0, maxArchiveBytes},
+		{1024, 512, 1024},
+		{100 << 20, 20 << 20, maxArchiveBytes},
+	}
+	for _, tt := range tests {
+		if got := archiveLimit(&FetchOptions{MaxHTMLBytes: tt.html, MaxImageBytes: tt.image}); got != tt.want {
+			t.Errorf("archiveLimit(html=%d, image=%d) = %d, want %d", tt.html, tt.image, got, tt.want)
+		}
+	}
+}
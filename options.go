@@ -0,0 +1,241 @@
+package gospider
+
+import (
+	"gospider/internal"
+	"gospider/utils"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Option configures a Crawler
+type Option func(*Crawler)
+
+// config holds everything the options set
+type config struct {
+	seeds          []string
+	maxDomains     int // distinct hosts to crawl
+	maxURLs        int // 0 = unlimited
+	maxDepth       int // 0 = unlimited
+	maxOffsite     int // -1 = only maxDepth applies
+	workers        int
+	maxPerHost     int           // concurrent requests per host, 0 = unlimited
+	hostDelay      time.Duration // minimum time between requests to one host
+	client         *http.Client  // nil = built from proxyPool
+	proxyPool      *utils.ProxyPool
+	proxyAttempts  int
+	sinks          []Sink
+	stripParams    []string // extra query parameters dropped when deduplicating
+	scopeMode      string
+	allow          []string // regular expressions, see internal.NewScope
+	deny           []string
+	pathPrefixes   []string
+	denyExtensions []string
+	canonical      bool
+	respectRobots  bool
+	retry          RetryPolicy
+	maxRedirects   int
+	maxHTMLBytes   int64 // 0 = unlimited
+	maxImageBytes  int64 // 0 = unlimited
+	downloadImages bool
+	imageDir       string
+	extract        string
+	rules          *utils.RuleSet
+	processErrors  bool
+	checkpointDir  string
+	checkpointTick time.Duration
+	resume         *Checkpoint
+	log            io.Writer // where progress and verbose messages go
+	verbose        bool
+}
+
+// defaultConfig matches the CLI's defaults
+func defaultConfig() config {
+	return config{
+		maxDomains:     100,
+		maxURLs:        1000,
+		maxOffsite:     -1,
+		workers:        5,
+		maxPerHost:     8,
+		proxyAttempts:  3,
+		retry:          internal.DefaultRetryPolicy(),
+		maxRedirects:   internal.DefaultMaxRedirects,
+		maxHTMLBytes:   10 * 1024 * 1024,
+		maxImageBytes:  20 * 1024 * 1024,
+		extract:        ExtractFull,
+		scopeMode:      ScopeAny,
+		checkpointTick: 30 * time.Second,
+		log:            os.Stdout,
+	}
+}
+
+// WithSeeds adds URLs to start crawling from
+func WithSeeds(urls ...string) Option {
+	return func(c *Crawler) { c.cfg.seeds = append(c.cfg.seeds, urls...) }
+}
+
+// WithMaxURLs limits how many URLs are fetched (default 1000), 0 = unlimited
+func WithMaxURLs(n int) Option {
+	return func(c *Crawler) { c.cfg.maxURLs = n }
+}
+
+// WithMaxDomains limits how many distinct hosts are crawled (default 100)
+func WithMaxDomains(n int) Option {
+	return func(c *Crawler) { c.cfg.maxDomains = n }
+}
+
+// WithMaxDepth limits how many links are followed from a seed: 1 crawls the seeds and the
+// pages they link to. 0 = unlimited (default).
+func WithMaxDepth(n int) Option {
+	return func(c *Crawler) { c.cfg.maxDepth = n }
+}
+
+// WithMaxOffsiteDepth limits how many links are followed after leaving the seeds' registrable
+// domains: 0 never leaves them, 1 fetches the off-site pages they link to but goes no further.
+// -1 = only WithMaxDepth applies (default).
+func WithMaxOffsiteDepth(n int) Option {
+	return func(c *Crawler) { c.cfg.maxOffsite = n }
+}
+
+// WithWorkers sets the number of concurrent workers (default 5)
+func WithWorkers(n int) Option {
+	return func(c *Crawler) { c.cfg.workers = n }
+}
+
+// WithPoliteness limits concurrent requests per host (default 8, 0 = unlimited) and sets
+// the minimum delay between requests to the same host (default 0)
+func WithPoliteness(maxPerHost int, hostDelay time.Duration) Option {
+	return func(c *Crawler) {
+		c.cfg.maxPerHost = maxPerHost
+		c.cfg.hostDelay = hostDelay
+	}
+}
+
+// WithHTTPClient makes the crawler send requests with client. Its CheckRedirect is replaced
+// so redirects can be tracked; WithProxyPool is ignored when a client is given.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Crawler) { c.cfg.client = client }
+}
+
+// WithProxyPool routes every request through pool, trying up to attempts different
+// proxies per request (default 3)
+func WithProxyPool(pool *utils.ProxyPool, attempts int) Option {
+	return func(c *Crawler) {
+		c.cfg.proxyPool = pool
+		c.cfg.proxyAttempts = attempts
+	}
+}
+
+// WithSink adds outputs for crawled pages. The crawler closes them when Run returns.
+func WithSink(sinks ...Sink) Option {
+	return func(c *Crawler) { c.cfg.sinks = append(c.cfg.sinks, sinks...) }
+}
+
+// WithStripParams drops these query parameters, on top of utils.DefaultTrackingParams,
+// when deciding whether two URLs are the same page
+func WithStripParams(params ...string) Option {
+	return func(c *Crawler) { c.cfg.stripParams = append(c.cfg.stripParams, params...) }
+}
+
+// WithScope limits which hosts are crawled: ScopeHost (the seeds' hosts), ScopeDomain
+// (the seeds' registrable domains, subdomains included) or ScopeAny (default)
+func WithScope(mode string) Option {
+	return func(c *Crawler) { c.cfg.scopeMode = mode }
+}
+
+// WithAllow only crawls URLs matching at least one of these regular expressions
+func WithAllow(patterns ...string) Option {
+	return func(c *Crawler) { c.cfg.allow = append(c.cfg.allow, patterns...) }
+}
+
+// WithDeny skips URLs matching any of these regular expressions
+func WithDeny(patterns ...string) Option {
+	return func(c *Crawler) { c.cfg.deny = append(c.cfg.deny, patterns...) }
+}
+
+// WithPathPrefixes only crawls URLs whose path starts with one of these prefixes, e.g. "/docs/"
+func WithPathPrefixes(prefixes ...string) Option {
+	return func(c *Crawler) { c.cfg.pathPrefixes = append(c.cfg.pathPrefixes, prefixes...) }
+}
+
+// WithDenyExtensions skips URLs whose path ends in one of these extensions, e.g. "pdf" or ".zip"
+func WithDenyExtensions(extensions ...string) Option {
+	return func(c *Crawler) { c.cfg.denyExtensions = append(c.cfg.denyExtensions, extensions...) }
+}
+
+// WithCanonical skips pages whose <link rel="canonical"> points at a URL already crawled
+func WithCanonical(honour bool) Option {
+	return func(c *Crawler) { c.cfg.canonical = honour }
+}
+
+// WithRobots obeys robots.txt for every host
+func WithRobots(respect bool) Option {
+	return func(c *Crawler) { c.cfg.respectRobots = respect }
+}
+
+// WithRetry replaces DefaultRetryPolicy
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Crawler) { c.cfg.retry = policy }
+}
+
+// WithMaxRedirects sets how many redirect hops are followed per URL (default 10)
+func WithMaxRedirects(n int) Option {
+	return func(c *Crawler) { c.cfg.maxRedirects = n }
+}
+
+// WithSizeLimits sets the largest HTML page and image to download in bytes
+// (default 10MB and 20MB), 0 = unlimited
+func WithSizeLimits(maxHTMLBytes, maxImageBytes int64) Option {
+	return func(c *Crawler) {
+		c.cfg.maxHTMLBytes = maxHTMLBytes
+		c.cfg.maxImageBytes = maxImageBytes
+	}
+}
+
+// WithImages downloads images found while crawling to dir/<domain>/images ("output" when dir is empty)
+func WithImages(dir string) Option {
+	return func(c *Crawler) {
+		c.cfg.downloadImages = true
+		c.cfg.imageDir = dir
+	}
+}
+
+// WithExtract chooses what is converted to markdown: ExtractFull (default) or ExtractReadability
+func WithExtract(mode string) Option {
+	return func(c *Crawler) { c.cfg.extract = mode }
+}
+
+// WithRules extracts structured records from pages matching the rules
+func WithRules(rules *utils.RuleSet) Option {
+	return func(c *Crawler) { c.cfg.rules = rules }
+}
+
+// WithErrorPages converts, saves and extracts links from 3xx/4xx/5xx pages too
+func WithErrorPages(process bool) Option {
+	return func(c *Crawler) { c.cfg.processErrors = process }
+}
+
+// WithCheckpoint saves the crawl state to dir every interval and when Run returns
+func WithCheckpoint(dir string, interval time.Duration) Option {
+	return func(c *Crawler) {
+		c.cfg.checkpointDir = dir
+		c.cfg.checkpointTick = interval
+	}
+}
+
+// WithResume continues the crawl saved in cp instead of starting from the seeds
+func WithResume(cp *Checkpoint) Option {
+	return func(c *Crawler) { c.cfg.resume = cp }
+}
+
+// WithVerbose logs every URL and decision, to stdout unless WithLogOutput says otherwise
+func WithVerbose(verbose bool) Option {
+	return func(c *Crawler) { c.cfg.verbose = verbose }
+}
+
+// WithLogOutput sends the crawler's log messages to w instead of stdout, e.g. os.Stderr
+// when stdout carries JSON Lines
+func WithLogOutput(w io.Writer) Option {
+	return func(c *Crawler) { c.cfg.log = w }
+}
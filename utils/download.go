@@ -2,7 +2,10 @@ package utils
 
 import (
 	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -10,43 +13,59 @@ import (
 	"sync"
 )
 
-var (
-	imageDirCache   = make(map[string]bool)
-	imageDirCacheMu sync.RWMutex
-)
+// ImageStore saves downloaded images under root/<domain>/images, remembering which
+// directories it has already created
+type ImageStore struct {
+	root   string
+	dirs   map[string]bool
+	dirsMu sync.RWMutex
+	log    io.Writer // where verbose messages go, see SetLogOutput
+}
+
+// NewImageStore creates a store that writes under root ("output" when empty)
+func NewImageStore(root string) *ImageStore {
+	if root == "" {
+		root = "output"
+	}
+	return &ImageStore{root: root, dirs: make(map[string]bool), log: os.Stdout}
+}
+
+// SetLogOutput sends verbose messages to w instead of stdout
+func (s *ImageStore) SetLogOutput(w io.Writer) {
+	s.log = w
+}
 
-// ensureImageDir creates directory only if it doesn't exist (cached)
-func ensureImageDir(dir string) error {
-	imageDirCacheMu.RLock()
-	if imageDirCache[dir] {
-		imageDirCacheMu.RUnlock()
+// ensureDir creates directory only if it doesn't exist (cached)
+func (s *ImageStore) ensureDir(dir string) error {
+	s.dirsMu.RLock()
+	if s.dirs[dir] {
+		s.dirsMu.RUnlock()
 		return nil
 	}
-	imageDirCacheMu.RUnlock()
+	s.dirsMu.RUnlock()
+
+	s.dirsMu.Lock()
+	defer s.dirsMu.Unlock()
 
-	imageDirCacheMu.Lock()
-	defer imageDirCacheMu.Unlock()
-	
 	// Double-check after acquiring write lock
-	if imageDirCache[dir] {
+	if s.dirs[dir] {
 		return nil
 	}
-	
+
 	err := os.MkdirAll(dir, 0755)
 	if err == nil {
-		imageDirCache[dir] = true
+		s.dirs[dir] = true
 	}
 	return err
 }
 
-// DownloadImage saves an image to the images folder within the domain directory using high-speed writer
-func DownloadImage(imageData []byte, urlStr string, verbose bool) {
+// imagePath returns the directory and file an image URL is saved to. The file keeps the
+// URL's base name with a hash of the whole URL added, so /a/logo.png, /b/logo.png and
+// logo.png?v=2 never overwrite each other.
+func (s *ImageStore) imagePath(urlStr string) (string, string, error) {
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
-		if verbose {
-			fmt.Printf("Error parsing image URL %s: %v\n", urlStr, err)
-		}
-		return
+		return "", "", err
 	}
 
 	// Get domain
@@ -55,34 +74,71 @@ func DownloadImage(imageData []byte, urlStr string, verbose bool) {
 		domain = "unknown"
 	}
 
-	// Simple filename: use the last part of URL or default
+	// Use the last part of the URL, or a default for bare directories
 	filename := filepath.Base(parsedURL.Path)
 	if filename == "/" || filename == "." || filename == "" {
 		filename = "image.jpg"
 	}
+	parsedURL.Fragment = ""
+	sum := sha1.Sum([]byte(parsedURL.String()))
+	ext := filepath.Ext(filename)
+	filename = strings.TrimSuffix(filename, ext) + "-" + hex.EncodeToString(sum[:4]) + ext
 
 	// Build full file path
-	outputDir := filepath.Join("output", domain, "images")
-	filePath := filepath.Join(outputDir, filename)
-
-	// Use high-speed file writer for maximum throughput
-	// Note: Need to import internal package or move this function
-	// For now, fall back to direct writing
-	ensureImageDir(outputDir)
-	file, err := os.Create(filePath)
+	outputDir := filepath.Join(s.root, domain, "images")
+	return outputDir, filepath.Join(outputDir, filename), nil
+}
+
+// SaveImageStream copies an image body straight to disk without buffering it in memory.
+// If maxBytes is positive and the body is larger, the partial file is removed and an error returned.
+func (s *ImageStore) SaveImageStream(body io.Reader, urlStr string, maxBytes int64, verbose bool) error {
+	outputDir, filePath, err := s.imagePath(urlStr)
 	if err != nil {
-		if verbose {
-			fmt.Printf("Error creating image file %s: %v\n", filePath, err)
-		}
-		return
+		return fmt.Errorf("error parsing image URL: %v", err)
+	}
+	if err := s.ensureDir(outputDir); err != nil {
+		return fmt.Errorf("error creating image dir %s: %v", outputDir, err)
 	}
-	defer file.Close()
 
+	// Write to a temporary file of our own so an aborted download never leaves a truncated
+	// image behind and concurrent downloads of the same image don't share one
+	file, err := os.CreateTemp(outputDir, filepath.Base(filePath)+".*.part")
+	if err != nil {
+		return fmt.Errorf("error creating image file in %s: %v", outputDir, err)
+	}
+	partPath := file.Name()
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		os.Remove(partPath)
+		return fmt.Errorf("error creating image file %s: %v", partPath, err)
+	}
+
+	if maxBytes > 0 {
+		body = io.LimitReader(body, maxBytes+1)
+	}
 	bufWriter := bufio.NewWriterSize(file, 1048576) // 1MB buffer
-	defer bufWriter.Flush()
-	bufWriter.Write(imageData)
+	written, err := io.Copy(bufWriter, body)
+	if err == nil {
+		err = bufWriter.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && maxBytes > 0 && written > maxBytes {
+		err = fmt.Errorf("image exceeds limit of %d bytes", maxBytes)
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return err
+	}
+
+	if err := os.Rename(partPath, filePath); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("error saving image file %s: %v", filePath, err)
+	}
 
 	if verbose {
-		fmt.Printf("Downloaded: %s -> %s\n", urlStr, filePath)
+		fmt.Fprintf(s.log, "Downloaded: %s -> %s (%d bytes)\n", urlStr, filePath, written)
 	}
+	return nil
 }
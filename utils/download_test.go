@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestImagePathsDoNotCollide(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	urls := []string{
+		"https://example.com/a/logo.png",
+		"https://example.com/b/logo.png",
+		"https://example.com/a/logo.png?v=2",
+		"https://www.example.com/a/logo.png",
+	}
+	seen := make(map[string]string)
+	for _, urlStr := range urls {
+		dir, path, err := store.imagePath(urlStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dir != filepath.Dir(path) || !strings.HasSuffix(path, ".png") || !strings.HasPrefix(filepath.Base(path), "logo-") {
+			t.Errorf("%s -> %s, want logo-<hash>.png in %s", urlStr, path, dir)
+		}
+		if other, ok := seen[path]; ok {
+			t.Errorf("%s and %s both save to %s", other, urlStr, path)
+		}
+		seen[path] = urlStr
+	}
+
+	// The fragment never reaches the server, so it names the same file
+	_, withFragment, _ := store.imagePath("https://example.com/a/logo.png#top")
+	if _, ok := seen[withFragment]; !ok {
+		t.Errorf("fragment changed the file name to %s", withFragment)
+	}
+}
+
+func TestConcurrentSavesOfOneImage(t *testing.T) {
+	root := t.TempDir()
+	store := NewImageStore(root)
+	const urlStr = "https://example.com/logo.png"
+	bodies := []string{strings.Repeat("a", 1<<16), strings.Repeat("b", 1<<16)}
+
+	var wg sync.WaitGroup
+	for _, body := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.SaveImageStream(strings.NewReader(body), urlStr, 0, false); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, path, _ := store.imagePath(urlStr)
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != bodies[0] && string(saved) != bodies[1] {
+		t.Error("concurrent downloads mixed their bytes in one file")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("images dir has %d files, want only the image and no .part leftovers", len(entries))
+	}
+}
@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// LinkKind separates pages we may crawl from resources a page embeds
+type LinkKind int
+
+const (
+	LinkNavigation LinkKind = iota // a, area, iframe, form, and link rel=next/prev/alternate
+	LinkAsset                      // img, stylesheets, icons and other embedded resources
+)
+
+func (k LinkKind) String() string {
+	if k == LinkAsset {
+		return "asset"
+	}
+	return "navigation"
+}
+
+// MarshalText writes the kind as "navigation" or "asset" in JSON output
+func (k LinkKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Link is a resolved URL found in an HTML document
+type Link struct {
+	URL  string   `json:"url"`
+	Kind LinkKind `json:"kind"`
+	Tag  string   `json:"tag"`            // element the link came from, e.g. "a" or "img"
+	Text string   `json:"text,omitempty"` // anchor text, or alt text for images and areas
+	Rel  []string `json:"rel,omitempty"`  // lowercased rel values, e.g. "nofollow"
+}
+
+// HasRel reports whether the link carries the given rel value
+func (l Link) HasRel(rel string) bool {
+	for _, r := range l.Rel {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// navigationRels are <link rel> values that point at other pages rather than assets
+var navigationRels = map[string]bool{
+	"alternate": true,
+	"canonical": true,
+	"next":      true,
+	"prev":      true,
+	"previous":  true,
+}
+
+// ParseHTML parses an HTML document so several extractors can share one tree
+func ParseHTML(body string) (*html.Node, error) {
+	return html.Parse(strings.NewReader(body))
+}
+
+// ExtractLinksFromDocument returns the links of a parsed HTML document resolved against pageURL,
+// which should be the final URL of the response. A <base href> in the document takes precedence.
+func ExtractLinksFromDocument(doc *html.Node, pageURL string) []Link {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+
+	// Only the first <base href> counts
+	if baseNode := findElement(doc, "base"); baseNode != nil {
+		if href, ok := getAttr(baseNode, "href"); ok {
+			if resolved, err := base.Parse(strings.TrimSpace(href)); err == nil {
+				base = resolved
+			}
+		}
+	}
+
+	var links []Link
+	seen := make(map[string]bool)
+	add := func(raw string, kind LinkKind, n *html.Node, text string) {
+		resolved, ok := resolveLink(base, raw)
+		if !ok || seen[resolved] {
+			return
+		}
+		seen[resolved] = true
+		links = append(links, Link{
+			URL:  resolved,
+			Kind: kind,
+			Tag:  n.Data,
+			Text: text,
+			Rel:  relValues(n),
+		})
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "a":
+				if href, ok := getAttr(n, "href"); ok {
+					add(href, LinkNavigation, n, collapseSpace(textContent(n)))
+				}
+			case "area":
+				if href, ok := getAttr(n, "href"); ok {
+					alt, _ := getAttr(n, "alt")
+					add(href, LinkNavigation, n, collapseSpace(alt))
+				}
+			case "iframe":
+				if src, ok := getAttr(n, "src"); ok {
+					title, _ := getAttr(n, "title")
+					add(src, LinkNavigation, n, collapseSpace(title))
+				}
+			case "form":
+				// Only GET forms can be followed without submitting data
+				method, _ := getAttr(n, "method")
+				if action, ok := getAttr(n, "action"); ok && (method == "" || strings.EqualFold(method, "get")) {
+					add(action, LinkNavigation, n, "")
+				}
+			case "link":
+				if href, ok := getAttr(n, "href"); ok {
+					kind := LinkAsset
+					for _, rel := range relValues(n) {
+						if navigationRels[rel] {
+							kind = LinkNavigation
+							break
+						}
+					}
+					title, _ := getAttr(n, "title")
+					add(href, kind, n, collapseSpace(title))
+				}
+			case "img", "source":
+				alt, _ := getAttr(n, "alt")
+				if src, ok := getAttr(n, "src"); ok {
+					add(src, LinkAsset, n, collapseSpace(alt))
+				}
+				if srcset, ok := getAttr(n, "srcset"); ok {
+					for _, candidate := range parseSrcset(srcset) {
+						add(candidate, LinkAsset, n, collapseSpace(alt))
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return links
+}
+
+// ExtractTitle returns the text of the document's <title>
+func ExtractTitle(doc *html.Node) string {
+	if title := findElement(doc, "title"); title != nil {
+		return collapseSpace(textContent(title))
+	}
+	return ""
+}
+
+// resolveLink turns a raw attribute value into an absolute http(s) URL without a fragment
+func resolveLink(base *url.URL, raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.HasPrefix(raw, "#") {
+		return "", false
+	}
+
+	resolved, err := base.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	// Skip javascript:, mailto:, tel:, data: and friends
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return "", false
+	}
+
+	// Fragments never reach the server
+	resolved.Fragment = ""
+	resolved.RawFragment = ""
+	return resolved.String(), true
+}
+
+// parseSrcset returns the URLs from a srcset attribute, dropping width/density descriptors
+func parseSrcset(srcset string) []string {
+	var urls []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+// relValues returns the lowercased, space-separated values of an element's rel attribute
+func relValues(n *html.Node) []string {
+	rel, ok := getAttr(n, "rel")
+	if !ok {
+		return nil
+	}
+	return strings.Fields(strings.ToLower(rel))
+}
+
+// getAttr returns an attribute value from an element
+func getAttr(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// findElement returns the first element with the given tag name in document order
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textContent concatenates all text below a node
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// collapseSpace trims text and squeezes runs of whitespace into single spaces
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// extractLinks parses body and extracts its links as seen from pageURL
+func extractLinks(t *testing.T, body, pageURL string) []Link {
+	t.Helper()
+	doc, err := ParseHTML(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ExtractLinksFromDocument(doc, pageURL)
+}
+
+func TestExtractLinksFromDocument(t *testing.T) {
+	links := extractLinks(t, `<html><head>
+		<link rel="stylesheet" href="/style.css">
+		<link rel="Next" href="page2.html" title="Page 2">
+		<link rel="canonical" href="https://example.com/docs/">
+	</head><body>
+		<a href="intro.html">  Intro
+			page </a>
+		<a href="../up.html#section" rel="nofollow noopener">Up</a>
+		<a href="intro.html">duplicate</a>
+		<a href="#top">fragment only</a>
+		<a href="mailto:me@example.com">mail</a>
+		<a href="javascript:void(0)">js</a>
+		<a href="  ">blank</a>
+		<a>no href</a>
+		<map><area href="/map.html" alt="Map"></map>
+		<iframe src="//cdn.example.com/embed" title="Embed"></iframe>
+		<form action="/search"></form>
+		<form action="/find" method="GET"></form>
+		<form action="/login" method="post"></form>
+		<img src="logo.png" alt="Logo" srcset="logo-2x.png 2x, /img/logo-3x.png 3x">
+		<picture><source srcset="hero-480.webp 480w,hero-800.webp 800w"></picture>
+	</body></html>`, "https://example.com/docs/guide/")
+
+	want := []Link{
+		{URL: "https://example.com/style.css", Kind: LinkAsset, Tag: "link", Rel: []string{"stylesheet"}},
+		{URL: "https://example.com/docs/guide/page2.html", Kind: LinkNavigation, Tag: "link", Text: "Page 2", Rel: []string{"next"}},
+		{URL: "https://example.com/docs/", Kind: LinkNavigation, Tag: "link", Rel: []string{"canonical"}},
+		{URL: "https://example.com/docs/guide/intro.html", Kind: LinkNavigation, Tag: "a", Text: "Intro page"},
+		{URL: "https://example.com/docs/up.html", Kind: LinkNavigation, Tag: "a", Text: "Up", Rel: []string{"nofollow", "noopener"}},
+		{URL: "https://example.com/map.html", Kind: LinkNavigation, Tag: "area", Text: "Map"},
+		{URL: "https://cdn.example.com/embed", Kind: LinkNavigation, Tag: "iframe", Text: "Embed"},
+		{URL: "https://example.com/search", Kind: LinkNavigation, Tag: "form"},
+		{URL: "https://example.com/find", Kind: LinkNavigation, Tag: "form"},
+		{URL: "https://example.com/docs/guide/logo.png", Kind: LinkAsset, Tag: "img", Text: "Logo"},
+		{URL: "https://example.com/docs/guide/logo-2x.png", Kind: LinkAsset, Tag: "img", Text: "Logo"},
+		{URL: "https://example.com/img/logo-3x.png", Kind: LinkAsset, Tag: "img", Text: "Logo"},
+		{URL: "https://example.com/docs/guide/hero-480.webp", Kind: LinkAsset, Tag: "source"},
+		{URL: "https://example.com/docs/guide/hero-800.webp", Kind: LinkAsset, Tag: "source"},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %d links:", len(links))
+		for _, link := range links {
+			t.Errorf("  %+v", link)
+		}
+	}
+	if !links[4].HasRel("nofollow") || links[3].HasRel("nofollow") {
+		t.Error("HasRel does not match the rel values")
+	}
+}
+
+func TestExtractLinksBaseHref(t *testing.T) {
+	tests := []struct {
+		name, head, want string
+	}{
+		{"absolute base", `<base href="https://cdn.example.com/v2/">`, "https://cdn.example.com/v2/page.html"},
+		{"relative base", `<base href="/root/">`, "https://example.com/root/page.html"},
+		{"first base wins", `<base href="/one/"><base href="/two/">`, "https://example.com/one/page.html"},
+		{"base without href", `<base target="_blank">`, "https://example.com/a/b/page.html"},
+		{"no base", ``, "https://example.com/a/b/page.html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := extractLinks(t, `<html><head>`+tt.head+`</head><body><a href="page.html">p</a></body></html>`, "https://example.com/a/b/index.html")
+			if len(links) != 1 || links[0].URL != tt.want {
+				t.Errorf("links = %+v, want %s", links, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractLinksBadPageURL(t *testing.T) {
+	if links := extractLinks(t, `<a href="/x">x</a>`, "http://[bad"); links != nil {
+		t.Errorf("got %v for an unparseable page URL, want nil", links)
+	}
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// PageMeta is the document metadata found in an HTML page's <head>
+type PageMeta struct {
+	Description string `json:"description,omitempty"`
+	Canonical   string `json:"canonical,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Author      string `json:"author,omitempty"`
+	Published   string `json:"published,omitempty"` // as written in the page, usually ISO 8601
+}
+
+// publishedNames are <meta name/property/itemprop> values that carry a publish date, best first
+var publishedNames = []string{
+	"article:published_time",
+	"datepublished",
+	"date",
+	"pubdate",
+	"publish_date",
+	"dc.date",
+	"dc.date.issued",
+	"dcterms.created",
+}
+
+// ExtractMeta reads description, language, author and publish date from a document.
+// The canonical URL is taken from links, which are already resolved.
+func ExtractMeta(doc *html.Node, links []Link) PageMeta {
+	var meta PageMeta
+	named := make(map[string]string)
+
+	if root := findElement(doc, "html"); root != nil {
+		if lang, ok := getAttr(root, "lang"); ok {
+			meta.Language = strings.TrimSpace(lang)
+		}
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "meta" {
+			content, ok := getAttr(n, "content")
+			content = collapseSpace(content)
+			if ok && content != "" {
+				for _, attr := range []string{"name", "property", "itemprop", "http-equiv"} {
+					key, found := getAttr(n, attr)
+					key = strings.ToLower(strings.TrimSpace(key))
+					if !found || key == "" {
+						continue
+					}
+					if _, seen := named[key]; !seen {
+						named[key] = content
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	meta.Description = firstOf(named, "description", "og:description", "twitter:description")
+	meta.Author = firstOf(named, "author", "article:author", "dc.creator")
+	meta.Published = firstOf(named, publishedNames...)
+	if meta.Language == "" {
+		meta.Language = named["content-language"]
+	}
+
+	for _, link := range links {
+		if link.Tag == "link" && link.HasRel("canonical") {
+			meta.Canonical = link.URL
+			break
+		}
+	}
+	return meta
+}
+
+// firstOf returns the value of the first key present in values
+func firstOf(values map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := values[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultTrackingParams are query parameters that never change page content.
+// A trailing * matches any parameter with that prefix. Short names such as "sid" are left out
+// because sites also use them for real content (a story or section ID); add them with WithStripParams.
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"msclkid",
+	"yclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+	"_gl",
+	"_hsenc",
+	"_hsmi",
+	"ref_src",
+	"jsessionid",
+	"phpsessid",
+	"aspsessionid*",
+	"sessionid",
+	"session_id",
+	"cfid",
+	"cftoken",
+}
+
+// URLNormalizer rewrites URLs into a canonical form so that duplicates share one key
+type URLNormalizer struct {
+	exact    map[string]bool
+	prefixes []string
+}
+
+// NewURLNormalizer creates a normalizer that drops the given query parameters (case-insensitive)
+func NewURLNormalizer(stripParams []string) *URLNormalizer {
+	n := &URLNormalizer{exact: make(map[string]bool)}
+	for _, param := range stripParams {
+		param = strings.ToLower(strings.TrimSpace(param))
+		if param == "" {
+			continue
+		}
+		if strings.HasSuffix(param, "*") {
+			n.prefixes = append(n.prefixes, strings.TrimSuffix(param, "*"))
+		} else {
+			n.exact[param] = true
+		}
+	}
+	return n
+}
+
+// shouldStrip reports whether a query parameter is on the strip list
+func (n *URLNormalizer) shouldStrip(name string) bool {
+	name = strings.ToLower(name)
+	if n.exact[name] {
+		return true
+	}
+	for _, prefix := range n.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize lowercases the scheme and host, drops default ports and fragments,
+// resolves dot segments, trims trailing slashes and sorts the remaining query parameters
+func (n *URLNormalizer) Normalize(rawURL string) (string, error) {
+	parsedURL, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if parsedURL.Host == "" {
+		return "", fmt.Errorf("url has no host: %s", rawURL)
+	}
+
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	parsedURL.User = nil
+
+	// Lowercase the host and drop the port if it is the scheme's default
+	host := strings.ToLower(parsedURL.Hostname())
+	port := parsedURL.Port()
+	if (parsedURL.Scheme == "http" && port == "80") || (parsedURL.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	host = strings.TrimSuffix(host, ".")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6 literal
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	parsedURL.Host = host
+
+	// Fragments never reach the server
+	parsedURL.Fragment = ""
+	parsedURL.RawFragment = ""
+
+	// Clean the path, dropping ;jsessionid=... style path parameters on the strip list
+	path := removeDotSegments(parsedURL.EscapedPath())
+	if i := strings.IndexByte(path, ';'); i >= 0 {
+		name, _, _ := strings.Cut(path[i+1:], "=")
+		if n.shouldStrip(name) {
+			path = path[:i]
+		}
+	}
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if path == "" {
+		path = "/"
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		parsedURL.Path = unescaped
+		parsedURL.RawPath = path
+	}
+
+	// Drop tracking parameters and sort the rest by name, keeping repeated values in order
+	var params []string
+	for _, param := range strings.Split(parsedURL.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(param, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if n.shouldStrip(name) {
+			continue
+		}
+		params = append(params, param)
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		nameI, _, _ := strings.Cut(params[i], "=")
+		nameJ, _, _ := strings.Cut(params[j], "=")
+		return nameI < nameJ
+	})
+	parsedURL.RawQuery = strings.Join(params, "&")
+	parsedURL.ForceQuery = false
+
+	return parsedURL.String(), nil
+}
+
+// removeDotSegments resolves "." and ".." in a path as described in RFC 3986 section 5.2.4
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	var output []string
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			if len(output) > 1 {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+
+	result := strings.Join(output, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
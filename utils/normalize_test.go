@@ -0,0 +1,81 @@
+package utils
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	n := NewURLNormalizer(DefaultTrackingParams)
+	tests := []struct {
+		name, in, want string
+	}{
+		// Scheme, host and default ports
+		{"lowercase scheme and host", "HTTP://Example.COM/Path", "http://example.com/Path"},
+		{"drop http port 80", "http://example.com:80/a", "http://example.com/a"},
+		{"drop https port 443", "https://example.com:443/a", "https://example.com/a"},
+		{"keep other ports", "http://example.com:8080/a", "http://example.com:8080/a"},
+		{"keep 443 on http", "http://example.com:443/a", "http://example.com:443/a"},
+		{"trailing dot in host", "http://example.com./a", "http://example.com/a"},
+		{"drop user info", "http://user:pw@example.com/a", "http://example.com/a"},
+		{"ipv6 host", "http://[::1]:80/a", "http://[::1]/a"},
+
+		// Paths
+		{"empty path", "http://example.com", "http://example.com/"},
+		{"root stays", "http://example.com/", "http://example.com/"},
+		{"trailing slash", "http://example.com/docs/", "http://example.com/docs"},
+		{"single dot", "http://example.com/a/./b", "http://example.com/a/b"},
+		{"double dot", "http://example.com/a/b/../c", "http://example.com/a/c"},
+		{"double dot above root", "http://example.com/../../a", "http://example.com/a"},
+		{"trailing double dot", "http://example.com/a/b/..", "http://example.com/a"},
+		{"dots in file names", "http://example.com/v1.2/file.tar.gz", "http://example.com/v1.2/file.tar.gz"},
+		{"escapes kept", "http://example.com/a%20b/c%2Fd", "http://example.com/a%20b/c%2Fd"},
+		{"session path parameter", "http://example.com/shop;jsessionid=ABC123", "http://example.com/shop"},
+		{"other path parameter", "http://example.com/shop;v=2", "http://example.com/shop;v=2"},
+
+		// Fragments
+		{"drop fragment", "http://example.com/a#section", "http://example.com/a"},
+		{"drop empty fragment", "http://example.com/a#", "http://example.com/a"},
+
+		// Query
+		{"sort parameters", "http://example.com/?b=2&a=1&c=3", "http://example.com/?a=1&b=2&c=3"},
+		{"repeated values keep order", "http://example.com/?t=2&a=1&t=1", "http://example.com/?a=1&t=2&t=1"},
+		{"drop empty query", "http://example.com/a?", "http://example.com/a"},
+		{"drop empty pairs", "http://example.com/a?&x=1&&", "http://example.com/a?x=1"},
+		{"utm prefix", "http://example.com/a?utm_source=x&utm_medium=y&id=7", "http://example.com/a?id=7"},
+		{"click ids", "http://example.com/a?fbclid=1&gclid=2&msclkid=3", "http://example.com/a"},
+		{"case-insensitive names", "http://example.com/a?UTM_Campaign=x&FBCLID=1&q=go", "http://example.com/a?q=go"},
+		{"escaped names", "http://example.com/a?utm%5Fsource=x&q=go", "http://example.com/a?q=go"},
+		{"session ids", "http://example.com/a?PHPSESSID=1&jsessionid=2&page=3", "http://example.com/a?page=3"},
+		{"sid is content", "http://example.com/story?sid=42", "http://example.com/story?sid=42"},
+		{"values are not names", "http://example.com/a?q=utm_source", "http://example.com/a?q=utm_source"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := n.Normalize(tt.in)
+			if err != nil {
+				t.Fatalf("Normalize(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeExtraParams(t *testing.T) {
+	n := NewURLNormalizer(append([]string{" SID ", "", "ref*"}, DefaultTrackingParams...))
+	got, err := n.Normalize("http://example.com/a?sid=1&referrer=x&ref=y&id=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://example.com/a?id=2"; got != want {
+		t.Errorf("Normalize = %q, want %q", got, want)
+	}
+}
+
+func TestNormalizeRejectsURLsWithoutHost(t *testing.T) {
+	n := NewURLNormalizer(nil)
+	for _, raw := range []string{"/relative/path", "mailto:me@example.com", "http://[bad"} {
+		if got, err := n.Normalize(raw); err == nil {
+			t.Errorf("Normalize(%q) = %q, want an error", raw, got)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProxyTestURL echoes the request's headers and origin IP, which is what the anonymity check needs
+const DefaultProxyTestURL = "http://httpbin.org/get"
+
+// Anonymity levels, from least to most private
+const (
+	AnonymityUnknown     = "unknown"     // our real IP could not be determined
+	AnonymityTransparent = "transparent" // the target sees our real IP
+	AnonymityAnonymous   = "anonymous"   // real IP hidden, but the proxy announces itself
+	AnonymityElite       = "elite"       // looks like a direct visitor
+)
+
+var anonymityRank = map[string]int{
+	AnonymityUnknown:     0,
+	AnonymityTransparent: 1,
+	AnonymityAnonymous:   2,
+	AnonymityElite:       3,
+}
+
+// AnonymityAtLeast reports whether level is at least as private as min
+func AnonymityAtLeast(level, min string) bool {
+	return anonymityRank[level] >= anonymityRank[min]
+}
+
+var (
+	// ipv4Regex finds IPv4 addresses in an echoed response
+	ipv4Regex = regexp.MustCompile(`\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}\b`)
+	// proxyHeaderRegex finds headers that proxies add to announce themselves, as echoed by the target
+	proxyHeaderRegex = regexp.MustCompile(`(?i)\b(via|x-forwarded-for|forwarded|x-real-ip|x-proxy-id|proxy-connection|client-ip)"?\s*:`)
+)
+
+// ProxyCheckOptions configures CheckProxies
+type ProxyCheckOptions struct {
+	TestURL   string        // page fetched through every proxy; it should echo the request headers
+	Timeout   time.Duration // per proxy
+	Workers   int           // proxies checked at once
+	RealIP    string        // our public IP; discovered with a direct request to TestURL when empty
+	UserAgent string
+	Log       io.Writer // where progress goes, nil = stdout
+	Verbose   bool
+}
+
+// ProxyCheckResult is the outcome of checking one proxy
+type ProxyCheckResult struct {
+	Proxy      string // proxy URL as given, credentials included
+	OK         bool
+	StatusCode int
+	Latency    time.Duration // time to fetch the whole test page
+	Anonymity  string
+	Err        error
+}
+
+// CheckProxies fetches opts.TestURL through every proxy concurrently and rates each one's
+// latency and anonymity. Working proxies come first, fastest first, then the failures in input order.
+func CheckProxies(ctx context.Context, proxies []string, opts ProxyCheckOptions) []ProxyCheckResult {
+	if opts.TestURL == "" {
+		opts.TestURL = DefaultProxyTestURL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.Log == nil {
+		opts.Log = os.Stdout
+	}
+
+	realIP := opts.RealIP
+	if realIP == "" {
+		ip, err := DiscoverRealIP(ctx, opts.TestURL, opts.Timeout, opts.UserAgent)
+		if err != nil {
+			fmt.Fprintf(opts.Log, "Could not determine our real IP (%v); anonymity will be reported as unknown\n", err)
+		} else if opts.Verbose {
+			fmt.Fprintf(opts.Log, "Real IP as seen by %s: %s\n", opts.TestURL, ip)
+		}
+		realIP = ip
+	}
+
+	// Proxies never handed to a worker keep this result
+	results := make([]ProxyCheckResult, len(proxies))
+	for i, proxy := range proxies {
+		results[i] = ProxyCheckResult{Proxy: proxy, Anonymity: AnonymityUnknown, Err: errors.New("not checked (interrupted)")}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(opts.Workers, len(proxies)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = checkProxy(ctx, proxies[i], realIP, opts)
+				if opts.Verbose {
+					if results[i].OK {
+						fmt.Fprintf(opts.Log, "✓ %s %s (%s)\n", RedactProxy(proxies[i]), results[i].Latency.Round(time.Millisecond), results[i].Anonymity)
+					} else {
+						fmt.Fprintf(opts.Log, "✗ %s: %v\n", RedactProxy(proxies[i]), results[i].Err)
+					}
+				}
+			}
+		}()
+	}
+dispatch:
+	for i := range proxies {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].OK != results[j].OK {
+			return results[i].OK
+		}
+		return results[i].OK && results[i].Latency < results[j].Latency
+	})
+	return results
+}
+
+// checkProxy fetches the test page through one proxy
+func checkProxy(ctx context.Context, proxy string, realIP string, opts ProxyCheckOptions) ProxyCheckResult {
+	result := ProxyCheckResult{Proxy: proxy, Anonymity: AnonymityUnknown}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || !validProxyURL(proxyURL) {
+		result.Err = fmt.Errorf("invalid proxy URL")
+		return result
+	}
+
+	transport := NewTransport()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	transport.DisableKeepAlives = true
+	client := &http.Client{Transport: transport, Timeout: opts.Timeout}
+	defer transport.CloseIdleConnections()
+
+	start := time.Now()
+	body, status, err := fetchEcho(ctx, client, opts.TestURL, opts.UserAgent)
+	result.StatusCode = status
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Latency = time.Since(start)
+	if status < 200 || status > 299 {
+		result.Err = fmt.Errorf("test URL returned status %d", status)
+		return result
+	}
+	result.OK = true
+
+	switch {
+	case realIP == "":
+	case containsIP(body, realIP):
+		result.Anonymity = AnonymityTransparent
+	case proxyHeaderRegex.MatchString(body):
+		result.Anonymity = AnonymityAnonymous
+	default:
+		result.Anonymity = AnonymityElite
+	}
+	return result
+}
+
+// DiscoverRealIP fetches testURL directly and returns the first IP address in the response,
+// which for echo services like httpbin.org/get or api.ipify.org is our public IP
+func DiscoverRealIP(ctx context.Context, testURL string, timeout time.Duration, userAgent string) (string, error) {
+	transport := NewTransport()
+	transport.Proxy = nil // bypass HTTP_PROXY too
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: timeout}
+	body, status, err := fetchEcho(ctx, client, testURL, userAgent)
+	if err != nil {
+		return "", err
+	}
+	if status < 200 || status > 299 {
+		return "", fmt.Errorf("test URL returned status %d", status)
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(body)); ip != nil {
+		return ip.String(), nil
+	}
+	for _, candidate := range ipv4Regex.FindAllString(body, -1) {
+		if net.ParseIP(candidate) != nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no IP address in the response from %s", testURL)
+}
+
+// fetchEcho GETs target and returns up to 1MB of the body
+func fetchEcho(ctx context.Context, client *http.Client, target string, userAgent string) (string, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return "", resp.StatusCode, err
+	}
+	return string(body), resp.StatusCode, nil
+}
+
+// containsIP reports whether ip appears in text as a whole address, not as part of a longer one
+func containsIP(text string, ip string) bool {
+	if strings.Contains(ip, ":") {
+		return strings.Contains(text, ip) // IPv6
+	}
+	for _, candidate := range ipv4Regex.FindAllString(text, -1) {
+		if candidate == ip {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testRealIP stands in for our public IP; on loopback every connection comes from 127.0.0.1,
+// so the transparent proxy below leaks this address instead
+const testRealIP = "198.51.100.7"
+
+// headerEcho answers like httpbin.org/get: the request headers plus the origin IP, taken
+// from X-Forwarded-For when a proxy set it
+func headerEcho(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			origin = forwarded
+		}
+		headers := make(map[string]string)
+		for key := range r.Header {
+			headers[key] = r.Header.Get(key)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"headers": headers, "origin": origin})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// checkedProxy is a forward proxy that adds headers to every request, after delay
+func checkedProxy(t *testing.T, headers map[string]string, delay time.Duration) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		outReq := r.Clone(r.Context())
+		outReq.RequestURI = ""
+		for key, value := range headers {
+			outReq.Header.Set(key, value)
+		}
+		resp, err := http.DefaultTransport.RoundTrip(outReq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestCheckProxies(t *testing.T) {
+	echo := headerEcho(t)
+	transparent := checkedProxy(t, map[string]string{"X-Forwarded-For": testRealIP}, 0)
+	anonymous := checkedProxy(t, map[string]string{"Via": "1.1 testproxy"}, 0)
+	elite := checkedProxy(t, nil, 50*time.Millisecond)
+
+	refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(refusing.Close)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	proxies := []string{closed.URL, elite, refusing.URL, transparent, anonymous}
+	results := CheckProxies(context.Background(), proxies, ProxyCheckOptions{
+		TestURL: echo.URL,
+		Timeout: 2 * time.Second,
+		Workers: len(proxies),
+		RealIP:  testRealIP,
+	})
+	if len(results) != len(proxies) {
+		t.Fatalf("got %d results, want %d", len(results), len(proxies))
+	}
+
+	byProxy := make(map[string]ProxyCheckResult)
+	for _, result := range results {
+		byProxy[result.Proxy] = result
+	}
+	wantAnonymity := map[string]string{
+		transparent: AnonymityTransparent,
+		anonymous:   AnonymityAnonymous,
+		elite:       AnonymityElite,
+	}
+	for proxy, want := range wantAnonymity {
+		if result := byProxy[proxy]; !result.OK || result.Anonymity != want {
+			t.Errorf("%s: OK=%t anonymity=%s err=%v; want a working %s proxy", proxy, result.OK, result.Anonymity, result.Err, want)
+		}
+	}
+	if result := byProxy[refusing.URL]; result.OK || result.StatusCode != http.StatusForbidden {
+		t.Errorf("refusing proxy: OK=%t status=%d, want a failed 403", result.OK, result.StatusCode)
+	}
+	if result := byProxy[closed.URL]; result.OK || result.Err == nil {
+		t.Errorf("unreachable proxy: OK=%t err=%v, want a failure", result.OK, result.Err)
+	}
+
+	// Working proxies first, fastest first, then failures in input order
+	for i := 0; i < 3; i++ {
+		if !results[i].OK {
+			t.Fatalf("result %d (%s) failed, want the working proxies first", i, results[i].Proxy)
+		}
+	}
+	if results[0].Latency > results[1].Latency || results[1].Latency > results[2].Latency {
+		t.Errorf("working proxies not sorted by latency: %s, %s, %s", results[0].Latency, results[1].Latency, results[2].Latency)
+	}
+	if results[2].Proxy != elite {
+		t.Errorf("slowest working proxy = %s, want the delayed elite proxy", results[2].Proxy)
+	}
+	if results[3].Proxy != closed.URL || results[4].Proxy != refusing.URL {
+		t.Errorf("failures = %s, %s; want them in input order", results[3].Proxy, results[4].Proxy)
+	}
+}
+
+func TestCheckProxiesUnknownRealIP(t *testing.T) {
+	// Without RealIP the check asks the test URL directly for our address
+	echo := headerEcho(t)
+	ip, err := DiscoverRealIP(context.Background(), echo.URL, time.Second, "")
+	if err != nil || ip != "127.0.0.1" {
+		t.Fatalf("DiscoverRealIP = %q, %v; want 127.0.0.1", ip, err)
+	}
+
+	// A test URL that echoes no address leaves anonymity unknown
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "no address here")
+	}))
+	t.Cleanup(broken.Close)
+	proxy := checkedProxy(t, nil, 0)
+	results := CheckProxies(context.Background(), []string{proxy}, ProxyCheckOptions{TestURL: broken.URL, Timeout: time.Second})
+	if !results[0].OK || results[0].Anonymity != AnonymityUnknown {
+		t.Errorf("result = OK=%t anonymity=%s, want a working proxy of unknown anonymity", results[0].OK, results[0].Anonymity)
+	}
+}
+
+func TestCheckProxiesInterrupted(t *testing.T) {
+	echo := headerEcho(t)
+	proxy := checkedProxy(t, nil, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := CheckProxies(ctx, []string{proxy, proxy, proxy}, ProxyCheckOptions{TestURL: echo.URL, RealIP: testRealIP})
+	for _, result := range results {
+		if result.OK || result.Err == nil {
+			t.Errorf("%s checked after cancellation: OK=%t err=%v", result.Proxy, result.OK, result.Err)
+		}
+	}
+}
+
+func TestContainsIP(t *testing.T) {
+	tests := []struct {
+		text, ip string
+		want     bool
+	}{
+		{`{"origin": "1.2.3.4"}`, "1.2.3.4", true},
+		{`{"origin": "11.2.3.45"}`, "1.2.3.4", false},
+		{`{"origin": "1.2.3.4, 5.6.7.8"}`, "5.6.7.8", true},
+		{`{"origin": "2001:db8::1"}`, "2001:db8::1", true},
+	}
+	for _, tt := range tests {
+		if got := containsIP(tt.text, tt.ip); got != tt.want {
+			t.Errorf("containsIP(%q, %q) = %t, want %t", tt.text, tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Proxy selection modes
+const (
+	ProxyRotate = "rotate" // a different proxy for every request
+	ProxySticky = "sticky" // one proxy per host until it fails
+)
+
+const (
+	proxyBenchBase = 30 * time.Second // bench time after the first consecutive failure, doubled after each further one
+	proxyBenchMax  = 10 * time.Minute
+)
+
+// proxyState is the health record of one proxy
+type proxyState struct {
+	url          *url.URL
+	successes    int
+	failures     int
+	consecutive  int // failures since the last success
+	totalLatency time.Duration
+	benchedUntil time.Time
+}
+
+// ProxyStats is a snapshot of one proxy's health for reporting
+type ProxyStats struct {
+	Proxy        string
+	Successes    int
+	Failures     int
+	AvgLatency   time.Duration
+	BenchedUntil time.Time // zero when the proxy is in rotation
+}
+
+// ProxyPool hands out proxies per request or per host and benches the ones that fail
+type ProxyPool struct {
+	proxies []*proxyState
+	byHost  map[string]*proxyState // sticky assignments
+	sticky  bool
+	next    int
+	mu      sync.Mutex
+	verbose bool
+	log     io.Writer // where verbose messages go, see SetLogOutput
+}
+
+// NewProxyPool creates a pool from proxy URLs (see ParseProxies); mode is ProxyRotate or ProxySticky
+func NewProxyPool(proxies []string, mode string, verbose bool) (*ProxyPool, error) {
+	if mode != ProxyRotate && mode != ProxySticky {
+		return nil, fmt.Errorf("unknown proxy mode %q (want %s or %s)", mode, ProxyRotate, ProxySticky)
+	}
+
+	pool := &ProxyPool{
+		byHost:  make(map[string]*proxyState),
+		sticky:  mode == ProxySticky,
+		verbose: verbose,
+		log:     os.Stdout,
+	}
+	for _, proxy := range proxies {
+		normalized, err := ParseProxyURL(proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxyURL, err := url.Parse(normalized)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %s: %v", RedactProxy(proxy), err)
+		}
+		pool.proxies = append(pool.proxies, &proxyState{url: proxyURL})
+	}
+	if len(pool.proxies) == 0 {
+		return nil, errors.New("no proxies to use")
+	}
+	return pool, nil
+}
+
+// SetLogOutput sends verbose messages to w instead of stdout
+func (p *ProxyPool) SetLogOutput(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = w
+}
+
+// Len returns the number of proxies in the pool
+func (p *ProxyPool) Len() int {
+	return len(p.proxies)
+}
+
+// pick chooses a proxy for host that is not in tried. Benched proxies are skipped while
+// any other is available; if all are benched the one coming back soonest is used.
+func (p *ProxyPool) pick(host string, tried map[*proxyState]bool) *proxyState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.sticky {
+		if proxy, ok := p.byHost[host]; ok && !tried[proxy] && !now.Before(proxy.benchedUntil) {
+			return proxy
+		}
+	}
+
+	// Round-robin over healthy proxies
+	var fallback *proxyState
+	for i := 0; i < len(p.proxies); i++ {
+		proxy := p.proxies[(p.next+i)%len(p.proxies)]
+		if tried[proxy] {
+			continue
+		}
+		if now.Before(proxy.benchedUntil) {
+			if fallback == nil || proxy.benchedUntil.Before(fallback.benchedUntil) {
+				fallback = proxy
+			}
+			continue
+		}
+		p.next = (p.next + i + 1) % len(p.proxies)
+		if p.sticky {
+			p.byHost[host] = proxy
+		}
+		return proxy
+	}
+	return fallback
+}
+
+// reportSuccess records a working request through proxy
+func (p *ProxyPool) reportSuccess(proxy *proxyState, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proxy.successes++
+	proxy.consecutive = 0
+	proxy.totalLatency += latency
+	proxy.benchedUntil = time.Time{}
+}
+
+// reportFailure records a failed request and benches the proxy, longer each time it fails in a row
+func (p *ProxyPool) reportFailure(proxy *proxyState, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proxy.failures++
+	proxy.consecutive++
+	bench := proxyBenchBase << min(proxy.consecutive-1, 10)
+	if bench > proxyBenchMax {
+		bench = proxyBenchMax
+	}
+	proxy.benchedUntil = time.Now().Add(bench)
+
+	// Sticky hosts move to another proxy on their next request
+	for host, assigned := range p.byHost {
+		if assigned == proxy {
+			delete(p.byHost, host)
+		}
+	}
+
+	if p.verbose {
+		fmt.Fprintf(p.log, "Proxy %s failed (%v), benched for %s\n", proxyName(proxy.url), err, bench)
+	}
+}
+
+// Stats returns per-proxy health, busiest first
+func (p *ProxyPool) Stats() []ProxyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]ProxyStats, 0, len(p.proxies))
+	for _, proxy := range p.proxies {
+		entry := ProxyStats{
+			Proxy:     proxyName(proxy.url),
+			Successes: proxy.successes,
+			Failures:  proxy.failures,
+		}
+		if proxy.successes > 0 {
+			entry.AvgLatency = proxy.totalLatency / time.Duration(proxy.successes)
+		}
+		if now.Before(proxy.benchedUntil) {
+			entry.BenchedUntil = proxy.benchedUntil
+		}
+		stats = append(stats, entry)
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Successes+stats[i].Failures > stats[j].Successes+stats[j].Failures
+	})
+	return stats
+}
+
+// proxyName identifies a proxy in logs and reports without its credentials
+func proxyName(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// proxyKey carries the chosen proxy from ProxyTransport to the transport's Proxy func
+type proxyKey struct{}
+
+// ProxyTransport sends each request through a proxy from the pool, retrying through
+// a different proxy when the proxy itself fails
+type ProxyTransport struct {
+	pool        *ProxyPool
+	base        *http.Transport
+	maxAttempts int
+}
+
+// proxyConnectError is a CONNECT request the proxy refused
+type proxyConnectError struct {
+	status string
+}
+
+func (e *proxyConnectError) Error() string {
+	return "proxy refused CONNECT: " + e.status
+}
+
+// isProxyFailure reports whether err means the proxy itself failed: it could not be reached,
+// or it refused the CONNECT tunnel or the SOCKS handshake. Anything else came from the target,
+// and another proxy would not do better.
+func isProxyFailure(err error) bool {
+	var connectErr *proxyConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "proxyconnect" || strings.HasPrefix(opErr.Op, "socks ")
+	}
+	return false
+}
+
+// NewProxyTransport wraps base so every request goes through pool. maxAttempts is how many
+// different proxies a request may try; base.Proxy and base.OnProxyConnectResponse are replaced.
+func NewProxyTransport(pool *ProxyPool, base *http.Transport, maxAttempts int) *ProxyTransport {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	base.Proxy = func(req *http.Request) (*url.URL, error) {
+		if proxy, ok := req.Context().Value(proxyKey{}).(*proxyState); ok {
+			return proxy.url, nil
+		}
+		return nil, nil
+	}
+	base.OnProxyConnectResponse = func(ctx context.Context, proxyURL *url.URL, connectReq *http.Request, resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK {
+			return &proxyConnectError{status: resp.Status}
+		}
+		return nil
+	}
+	return &ProxyTransport{pool: pool, base: base, maxAttempts: maxAttempts}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *ProxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests with a body that cannot be replayed get a single attempt
+	attempts := t.maxAttempts
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		attempts = 1
+	}
+
+	tried := make(map[*proxyState]bool)
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		proxy := t.pool.pick(req.URL.Host, tried)
+		if proxy == nil {
+			break
+		}
+		tried[proxy] = true
+
+		attemptReq := req.Clone(context.WithValue(req.Context(), proxyKey{}, proxy))
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+
+		start := time.Now()
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err == nil && resp.StatusCode != http.StatusProxyAuthRequired {
+			t.pool.reportSuccess(proxy, time.Since(start))
+			return resp, nil
+		}
+
+		// A cancelled request says nothing about the proxy
+		if req.Context().Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, req.Context().Err()
+		}
+
+		// Only failures of the proxy itself count against it
+		if err != nil && !isProxyFailure(err) {
+			return nil, err
+		}
+
+		if err == nil {
+			err = fmt.Errorf("proxy returned %s", resp.Status)
+			if attempt == attempts {
+				t.pool.reportFailure(proxy, err)
+				return resp, nil
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		t.pool.reportFailure(proxy, err)
+		lastErr = fmt.Errorf("via proxy %s: %w", proxyName(proxy.url), err)
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no proxy available")
+	}
+	return nil, lastErr
+}
+
+// CloseIdleConnections closes idle connections to every proxy
+func (t *ProxyTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
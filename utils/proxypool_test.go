@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// proxyStats returns the pool's record of its only proxy after one request to target
+func proxyStats(t *testing.T, proxy, target string) (ProxyStats, error) {
+	t.Helper()
+	pool, err := NewProxyPool([]string{proxy}, ProxyRotate, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := CreateHTTPClient(pool, 1).Get(target)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return pool.Stats()[0], err
+}
+
+func TestProxyFailuresBenchTheProxy(t *testing.T) {
+	target := echoTarget(t)
+	tlsTarget := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(tlsTarget.Close)
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	refusesConnect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(refusesConnect.Close)
+	var hits atomic.Int32
+	needsAuth := httpProxy(t, "bob", "s3cret", &hits)
+	socksAddr := socks5Proxy(t, "alice", "pw", &hits)
+
+	tests := []struct {
+		name, proxy, target string
+	}{
+		{"unreachable proxy", closed.URL, target.URL},
+		{"CONNECT refused", refusesConnect.URL, tlsTarget.URL},
+		{"407 from the proxy", needsAuth.URL, target.URL},
+		{"SOCKS handshake rejected", "socks5://alice:wrong@" + socksAddr, target.URL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, _ := proxyStats(t, tt.proxy, tt.target)
+			if stats.Failures != 1 || stats.BenchedUntil.IsZero() {
+				t.Errorf("failures=%d benched=%t, want the proxy benched after one failure", stats.Failures, !stats.BenchedUntil.IsZero())
+			}
+		})
+	}
+}
+
+func TestTargetFailuresDoNotBenchTheProxy(t *testing.T) {
+	// The target accepts the connection and hangs up without answering
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	var hits atomic.Int32
+	socksAddr := socks5Proxy(t, "", "", &hits)
+	stats, err := proxyStats(t, "socks5://"+socksAddr, "http://"+listener.Addr().String()+"/")
+	if err == nil {
+		t.Fatal("request to a target that hangs up succeeded")
+	}
+	if strings.Contains(err.Error(), "via proxy") {
+		t.Errorf("error %q blames the proxy", err)
+	}
+	if stats.Failures != 0 || !stats.BenchedUntil.IsZero() {
+		t.Errorf("failures=%d benched=%t after a target failure, want the proxy left alone", stats.Failures, !stats.BenchedUntil.IsZero())
+	}
+}
+
+func TestIsProxyFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "proxyconnect", Net: "tcp", Err: &net.DNSError{}}, true},
+		{&net.OpError{Op: "socks connect", Net: "tcp"}, true},
+		{&proxyConnectError{status: "502 Bad Gateway"}, true},
+		{&net.OpError{Op: "dial", Net: "tcp"}, false},
+		{&net.OpError{Op: "read", Net: "tcp"}, false},
+		{http.ErrHandlerTimeout, false},
+	}
+	for _, tt := range tests {
+		if got := isProxyFailure(tt.err); got != tt.want {
+			t.Errorf("isProxyFailure(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	minParagraphLength = 25  // shorter blocks are ignored when scoring
+	minContentLength   = 250 // the winner needs at least this much text to be trusted
+	minContentScore    = 20  // ... and at least this score
+)
+
+var (
+	// Class and id hints, as used by Arc90's Readability
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumbs|combx|comment|community|cookie|consent|disqus|extra|footer|gdpr|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|modal|newsletter|subscribe|share`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveHints      = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeHints      = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// skippedTags never contain article text
+var skippedTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"nav": true, "aside": true, "footer": true, "header": true, "form": true,
+	"button": true, "input": true, "select": true, "textarea": true, "iframe": true,
+}
+
+// scoredTags are the blocks whose text is credited to their ancestors
+var scoredTags = map[string]bool{
+	"p": true, "pre": true, "td": true, "blockquote": true,
+}
+
+// ExtractMainContent finds the subtree most likely to hold the page's article, scoring
+// nodes by text length, commas, link density and semantic tags. It returns the subtree
+// rendered as HTML with boilerplate removed, or false when no candidate is convincing.
+func ExtractMainContent(doc *html.Node) (string, bool) {
+	body := findElement(doc, "body")
+	if body == nil {
+		return "", false
+	}
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	credit := func(n *html.Node, score float64) {
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if skippedTags[n.Data] || isUnlikely(n) {
+				return
+			}
+			if scoredTags[n.Data] || (n.Data == "div" && !hasBlockChildren(n)) {
+				text := collapseSpace(textContent(n))
+				if len(text) >= minParagraphLength {
+					// One point per block, one per comma, and up to three for length
+					score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+
+					// Ancestors share the credit: parent fully, grandparent half, then a third and so on
+					level := 0
+					for p := n.Parent; p != nil && p.Type == html.ElementNode && level < 5; p = p.Parent {
+						divider := float64(level + 1)
+						if level > 1 {
+							divider = float64(level) * 3
+						}
+						credit(p, score/divider)
+						level++
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+
+	// Penalise link-heavy candidates such as menus and tag clouds
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range candidates {
+		score := scores[n] * (1 - linkDensity(n))
+		if best == nil || score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil || bestScore < minContentScore || best == body {
+		return "", false
+	}
+	if len(collapseSpace(textContent(best))) < minContentLength {
+		return "", false
+	}
+
+	// Render a cleaned copy so the shared document stays intact for other extractors
+	clean := cloneClean(best)
+	var buf bytes.Buffer
+	if err := html.Render(&buf, clean); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// initialScore weights a node by its tag and class/id hints before any text is credited
+func initialScore(n *html.Node) float64 {
+	score := 0.0
+	switch n.Data {
+	case "article", "main":
+		score += 25
+	case "div":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	if role, _ := getAttr(n, "role"); role == "main" || role == "article" {
+		score += 25
+	}
+	return score + classWeight(n)
+}
+
+// classWeight is +25 for content-like class/id names and -25 for boilerplate-like ones
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, key := range []string{"class", "id"} {
+		value, ok := getAttr(n, key)
+		if !ok || value == "" {
+			continue
+		}
+		if negativeHints.MatchString(value) {
+			weight -= 25
+		}
+		if positiveHints.MatchString(value) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// isUnlikely reports whether an element's class, id or role marks it as boilerplate
+func isUnlikely(n *html.Node) bool {
+	if n.Data == "body" || n.Data == "article" || n.Data == "main" {
+		return false
+	}
+	if role, _ := getAttr(n, "role"); role == "navigation" || role == "banner" || role == "contentinfo" || role == "complementary" || role == "dialog" {
+		return true
+	}
+	class, _ := getAttr(n, "class")
+	id, _ := getAttr(n, "id")
+	hints := class + " " + id
+	return unlikelyCandidates.MatchString(hints) && !maybeCandidate.MatchString(hints)
+}
+
+// hasBlockChildren reports whether a div is a container rather than a paragraph in disguise
+func hasBlockChildren(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "div", "p", "pre", "table", "ul", "ol", "blockquote", "section", "article", "h1", "h2", "h3", "h4", "h5", "h6":
+			return true
+		}
+	}
+	return false
+}
+
+// linkDensity is the share of a node's text that sits inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(collapseSpace(textContent(n)))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			linked += len(collapseSpace(textContent(c)))
+			return
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return float64(linked) / float64(total)
+}
+
+// cloneClean deep-copies a subtree, leaving out boilerplate elements and link-heavy blocks
+func cloneClean(n *html.Node) *html.Node {
+	clone := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.CommentNode {
+			continue
+		}
+		if c.Type == html.ElementNode {
+			if skippedTags[c.Data] || isUnlikely(c) || classWeight(c) < 0 {
+				continue
+			}
+
+			// Lists and containers that are mostly links are navigation, not prose
+			switch c.Data {
+			case "ul", "ol", "div", "section", "table":
+				if text := collapseSpace(textContent(c)); len(text) > 0 && linkDensity(c) > 0.5 && strings.Count(text, ".") < 3 {
+					continue
+				}
+			}
+		}
+		clone.AppendChild(cloneClean(c))
+	}
+	return clone
+}
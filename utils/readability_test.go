@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadFixture parses a page from testdata/readability
+func loadFixture(t *testing.T, name string) string {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", "readability", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ParseHTML(string(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, ok := ExtractMainContent(doc)
+	if !ok {
+		return ""
+	}
+	return content
+}
+
+func TestExtractMainContent(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []string // text the winner must contain
+		notWant []string // boilerplate it must leave out
+	}{
+		{
+			fixture: "article.html",
+			want:    []string{"Tide pools form", "minus tide", "Bring a tide table"},
+			notWant: []string{"Popular posts", "Share on Twitter", "Privacy policy", "Contact"},
+		},
+		{
+			fixture: "nav_heavy.html",
+			want:    []string{"build artifacts are now cached", "Log streaming", "configuration loader"},
+			notWant: []string{"Installing the command line tool", "Opening support tickets"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			content := loadFixture(t, tt.fixture)
+			if content == "" {
+				t.Fatal("no main content found")
+			}
+			for _, text := range tt.want {
+				if !strings.Contains(content, text) {
+					t.Errorf("main content is missing %q", text)
+				}
+			}
+			for _, text := range tt.notWant {
+				if strings.Contains(content, text) {
+					t.Errorf("main content kept boilerplate %q", text)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractMainContentFallsBack(t *testing.T) {
+	if content := loadFixture(t, "low_confidence.html"); content != "" {
+		t.Errorf("low-confidence page returned main content %q, want the full-page fallback", content)
+	}
+}
@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// RuleSet maps URL patterns to CSS-selector field definitions. The file format is:
+//
+//	{"rules": [{"name": "book", "url": "catalogue/.+/index\\.html", "fields": {
+//	    "title":  {"selector": "h1"},
+//	    "price":  {"selector": ".price_color", "type": "float"},
+//	    "rating": {"selector": ".star-rating", "attr": "class", "regex": "star-rating (\\w+)"},
+//	    "tags":   {"selector": ".tag", "list": true},
+//	    "items":  {"selector": "article", "list": true, "fields": {"name": {"selector": "h3 a", "attr": "title"}}}
+//	}}]}
+//
+// Every rule whose url pattern matches a page produces one record.
+type RuleSet struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// Rule extracts one record from pages whose URL matches Pattern
+type Rule struct {
+	Name    string            `json:"name"`
+	Pattern string            `json:"url"` // regular expression matched against the page URL
+	Fields  map[string]*Field `json:"fields"`
+
+	pattern *regexp.Regexp
+}
+
+// Field describes how to pull one value out of a page or out of a parent field's match
+type Field struct {
+	Selector string            `json:"selector"`         // CSS selector; empty means the current element
+	Attr     string            `json:"attr,omitempty"`   // attribute to read; "text" (default) or "html" for contents
+	Type     string            `json:"type,omitempty"`   // string (default), int, float, bool or url
+	Regex    string            `json:"regex,omitempty"`  // keep the first capture group (or whole match) of the value
+	List     bool              `json:"list,omitempty"`   // collect every match instead of the first
+	Fields   map[string]*Field `json:"fields,omitempty"` // nested fields, evaluated inside each match
+
+	selector cascadia.Selector
+	regex    *regexp.Regexp
+}
+
+// Record is the structured data one rule extracted from a page
+type Record struct {
+	Rule string         `json:"rule"`
+	Data map[string]any `json:"data"`
+}
+
+// numberChars are kept when coercing text such as "£51.77" or "1,234 in stock" to a number
+var numberChars = regexp.MustCompile(`-?[0-9][0-9,]*(\.[0-9]+)?|-?\.[0-9]+`)
+
+// LoadRules reads and compiles a rules file
+func LoadRules(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules RuleSet
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	for i, rule := range rules.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule%d", i+1)
+		}
+		if rule.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("rule %s: invalid url pattern: %v", rule.Name, err)
+		}
+		if len(rule.Fields) == 0 {
+			return nil, fmt.Errorf("rule %s: no fields", rule.Name)
+		}
+		if err := compileFields(rule.Fields, rule.Name); err != nil {
+			return nil, err
+		}
+	}
+	return &rules, nil
+}
+
+// compileFields compiles selectors and regexes and checks types, recursing into nested fields
+func compileFields(fields map[string]*Field, path string) error {
+	for name, field := range fields {
+		where := path + "." + name
+		if field == nil {
+			return fmt.Errorf("field %s: empty definition", where)
+		}
+		if field.Selector != "" {
+			selector, err := cascadia.Compile(field.Selector)
+			if err != nil {
+				return fmt.Errorf("field %s: invalid selector %q: %v", where, field.Selector, err)
+			}
+			field.selector = selector
+		}
+		if field.Regex != "" {
+			regex, err := regexp.Compile(field.Regex)
+			if err != nil {
+				return fmt.Errorf("field %s: invalid regex: %v", where, err)
+			}
+			field.regex = regex
+		}
+		switch field.Type {
+		case "", "string", "int", "float", "bool", "url":
+		default:
+			return fmt.Errorf("field %s: unknown type %q", where, field.Type)
+		}
+		if len(field.Fields) > 0 {
+			if field.Type != "" || field.Attr != "" || field.Regex != "" {
+				return fmt.Errorf("field %s: nested fields cannot also set type, attr or regex", where)
+			}
+			if err := compileFields(field.Fields, where); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Extract runs every rule matching pageURL against the document. A nil RuleSet extracts nothing.
+func (rs *RuleSet) Extract(doc *html.Node, pageURL string) []Record {
+	if rs == nil {
+		return nil
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+
+	var records []Record
+	for _, rule := range rs.Rules {
+		if !rule.pattern.MatchString(pageURL) {
+			continue
+		}
+		records = append(records, Record{
+			Rule: rule.Name,
+			Data: extractFields(rule.Fields, doc, base),
+		})
+	}
+	return records
+}
+
+// extractFields evaluates fields inside scope; missing single values come out as nil
+func extractFields(fields map[string]*Field, scope *html.Node, base *url.URL) map[string]any {
+	data := make(map[string]any, len(fields))
+	for name, field := range fields {
+		data[name] = field.extract(scope, base)
+	}
+	return data
+}
+
+// extract returns the field's value (or list of values) within scope
+func (f *Field) extract(scope *html.Node, base *url.URL) any {
+	var matches []*html.Node
+	switch {
+	case f.Selector == "":
+		matches = []*html.Node{scope}
+	case f.List:
+		matches = f.selector.MatchAll(scope)
+	default:
+		if match := f.selector.MatchFirst(scope); match != nil {
+			matches = []*html.Node{match}
+		}
+	}
+
+	values := make([]any, 0, len(matches))
+	for _, match := range matches {
+		if len(f.Fields) > 0 {
+			values = append(values, extractFields(f.Fields, match, base))
+			continue
+		}
+		if value, ok := f.value(match, base); ok {
+			values = append(values, value)
+		}
+	}
+
+	if f.List {
+		return values
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+// value reads, filters and coerces a single element's value
+func (f *Field) value(n *html.Node, base *url.URL) (any, bool) {
+	var raw string
+	switch f.Attr {
+	case "", "text":
+		raw = collapseSpace(textContent(n))
+	case "html":
+		var buf bytes.Buffer
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			html.Render(&buf, c)
+		}
+		raw = strings.TrimSpace(buf.String())
+	default:
+		attr, ok := getAttr(n, f.Attr)
+		if !ok {
+			return nil, false
+		}
+		raw = strings.TrimSpace(attr)
+	}
+
+	if f.regex != nil {
+		match := f.regex.FindStringSubmatch(raw)
+		switch {
+		case match == nil:
+			return nil, false
+		case len(match) > 1:
+			raw = match[1]
+		default:
+			raw = match[0]
+		}
+	}
+
+	return coerce(raw, f.Type, base)
+}
+
+// coerce converts a raw string to the field's type, dropping values that do not convert
+func coerce(raw string, kind string, base *url.URL) (any, bool) {
+	switch kind {
+	case "int", "float":
+		number := strings.ReplaceAll(numberChars.FindString(raw), ",", "")
+		if number == "" {
+			return nil, false
+		}
+		if kind == "int" {
+			if i, err := strconv.ParseInt(number, 10, 64); err == nil {
+				return i, true
+			}
+			if f, err := strconv.ParseFloat(number, 64); err == nil {
+				return int64(f), true
+			}
+			return nil, false
+		}
+		f, err := strconv.ParseFloat(number, 64)
+		return f, err == nil
+	case "bool":
+		switch strings.ToLower(strings.TrimSpace(raw)) {
+		case "", "0", "false", "no", "off", "n":
+			return false, true
+		default:
+			return true, true
+		}
+	case "url":
+		resolved, err := base.Parse(strings.TrimSpace(raw))
+		if err != nil || raw == "" {
+			return nil, false
+		}
+		return resolved.String(), true
+	default:
+		return raw, true
+	}
+}
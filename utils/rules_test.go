@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeRules writes a rules file to a temp dir and returns its path
+func writeRules(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRulesValidation(t *testing.T) {
+	tests := []struct {
+		name, body, wantErr string
+	}{
+		{"bad JSON", `{"rules": [`, "failed to parse"},
+		{"bad url pattern", `{"rules": [{"name": "r", "url": "(", "fields": {"a": {"selector": "h1"}}}]}`, "rule r: invalid url pattern"},
+		{"no fields", `{"rules": [{"name": "r", "url": "x"}]}`, "rule r: no fields"},
+		{"empty field", `{"rules": [{"name": "r", "url": "x", "fields": {"a": null}}]}`, "field r.a: empty definition"},
+		{"bad selector", `{"rules": [{"name": "r", "url": "x", "fields": {"a": {"selector": "[["}}}]}`, "field r.a: invalid selector"},
+		{"bad regex", `{"rules": [{"name": "r", "url": "x", "fields": {"a": {"selector": "h1", "regex": "("}}}]}`, "field r.a: invalid regex"},
+		{"unknown type", `{"rules": [{"name": "r", "url": "x", "fields": {"a": {"selector": "h1", "type": "date"}}}]}`, `field r.a: unknown type "date"`},
+		{"nested with type", `{"rules": [{"name": "r", "url": "x", "fields": {"a": {"selector": "li", "type": "int", "fields": {"b": {}}}}}]}`, "field r.a: nested fields cannot also set"},
+		{"bad nested field", `{"rules": [{"name": "r", "url": "x", "fields": {"a": {"selector": "li", "fields": {"b": {"type": "date"}}}}}]}`, "field r.a.b: unknown type"},
+		{"unnamed rule", `{"rules": [{"url": "x", "fields": {"a": {"type": "date"}}}]}`, "field rule1.a: unknown type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadRules(writeRules(t, tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := LoadRules(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing rules file loaded")
+	}
+}
+
+func TestRuleSetExtract(t *testing.T) {
+	rules, err := LoadRules(filepath.Join("testdata", "rules", "catalogue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := os.ReadFile(filepath.Join("testdata", "rules", "catalogue.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ParseHTML(string(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := rules.Extract(doc, "https://books.example/catalogue/attic/index.html")
+	if len(records) != 2 || records[0].Rule != "book" || records[1].Rule != "rule2" {
+		t.Fatalf("got %d records, want book and rule2 (the other rule's URL does not match)", len(records))
+	}
+
+	want := map[string]any{
+		"title":     "A Light in the Attic",
+		"price":     51.77,
+		"stock":     int64(1234),
+		"rating":    "Three",
+		"in_stock":  true,
+		"dropped":   false,
+		"cover":     "https://books.example/catalogue/media/cover.jpg",
+		"blurb":     "<em>Funny</em> poems",
+		"isbn":      nil, // no match
+		"cover_alt": nil, // attribute missing
+		"tags":      []any{"poetry", "humour"},
+		"items": []any{
+			map[string]any{"name": "First", "link": "https://books.example/catalogue/attic/a.html", "qty": int64(3)},
+			map[string]any{"name": "Second", "link": "https://books.example/catalogue/attic/b.html", "qty": nil},
+		},
+	}
+	for name, value := range want {
+		if got := records[0].Data[name]; !reflect.DeepEqual(got, value) {
+			t.Errorf("%s = %#v, want %#v", name, got, value)
+		}
+	}
+	if got := records[1].Data["heading"]; got != "Light" {
+		t.Errorf("regex without a capture group = %#v, want the whole match", got)
+	}
+
+	if records := (*RuleSet)(nil).Extract(doc, "https://books.example/catalogue/"); records != nil {
+		t.Errorf("nil rule set extracted %v", records)
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	base, _ := url.Parse("https://example.com/shop/item.html")
+	tests := []struct {
+		raw, kind string
+		want      any
+		wantOK    bool
+	}{
+		{"£1,234.50", "float", 1234.5, true},
+		{"-.5 degrees", "float", -0.5, true},
+		{"12.9 kg", "int", int64(12), true},
+		{"no digits", "int", nil, false},
+		{"Off", "bool", false, true},
+		{"", "bool", false, true},
+		{"In stock", "bool", true, true},
+		{"/cart?id=1", "url", "https://example.com/cart?id=1", true},
+		{"", "url", nil, false},
+		{" kept as is ", "", " kept as is ", true},
+	}
+	for _, tt := range tests {
+		got, ok := coerce(tt.raw, tt.kind, base)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("coerce(%q, %q) = %#v, %t; want %#v, %t", tt.raw, tt.kind, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
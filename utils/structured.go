@@ -0,0 +1,292 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// StructuredData is the machine-readable data embedded in a page
+type StructuredData struct {
+	Items     []StructuredItem  `json:"items,omitempty"`     // JSON-LD and microdata items
+	OpenGraph map[string]string `json:"opengraph,omitempty"` // og:* properties without the prefix, first value wins
+	Twitter   map[string]string `json:"twitter,omitempty"`   // twitter:* card tags without the prefix
+}
+
+// StructuredItem is one schema.org (or other vocabulary) entity
+type StructuredItem struct {
+	Types      []string       `json:"types"`  // short type names, e.g. "Product"
+	Source     string         `json:"source"` // "json-ld" or "microdata"
+	Properties map[string]any `json:"properties"`
+}
+
+// IsEmpty reports whether the page carried no structured data at all
+func (sd *StructuredData) IsEmpty() bool {
+	return sd == nil || (len(sd.Items) == 0 && len(sd.OpenGraph) == 0 && len(sd.Twitter) == 0)
+}
+
+// SchemaTypes lists the types found on the page, for summary counts. Items contribute
+// their own types and an og:type contributes "og:<type>".
+func (sd *StructuredData) SchemaTypes() []string {
+	if sd == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var types []string
+	add := func(t string) {
+		if t != "" && !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	for _, item := range sd.Items {
+		for _, t := range item.Types {
+			add(t)
+		}
+	}
+	if ogType := sd.OpenGraph["type"]; ogType != "" {
+		add("og:" + ogType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ExtractStructuredData collects JSON-LD blocks, top-level microdata items and
+// OpenGraph/Twitter meta tags. Relative microdata URLs are resolved against pageURL.
+func ExtractStructuredData(doc *html.Node, pageURL string) *StructuredData {
+	base, _ := url.Parse(pageURL)
+	sd := &StructuredData{}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "script":
+				if scriptType, _ := getAttr(n, "type"); strings.EqualFold(strings.TrimSpace(scriptType), "application/ld+json") {
+					sd.Items = append(sd.Items, parseJSONLD(textContent(n))...)
+				}
+				return
+			case n.Data == "meta":
+				collectSocialMeta(n, sd)
+			case hasAttr(n, "itemscope") && !hasAttr(n, "itemprop"):
+				// Top-level microdata item; nested items are picked up as its properties
+				sd.Items = append(sd.Items, parseMicrodataItem(n, base))
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return sd
+}
+
+// collectSocialMeta stores og:* and twitter:* meta tags, keeping the first value of each
+func collectSocialMeta(n *html.Node, sd *StructuredData) {
+	content, ok := getAttr(n, "content")
+	content = collapseSpace(content)
+	if !ok || content == "" {
+		return
+	}
+	for _, attr := range []string{"property", "name"} {
+		key, _ := getAttr(n, attr)
+		key = strings.ToLower(strings.TrimSpace(key))
+		if og, isOG := strings.CutPrefix(key, "og:"); isOG && og != "" {
+			if sd.OpenGraph == nil {
+				sd.OpenGraph = make(map[string]string)
+			}
+			if _, seen := sd.OpenGraph[og]; !seen {
+				sd.OpenGraph[og] = content
+			}
+		}
+		if tw, isTwitter := strings.CutPrefix(key, "twitter:"); isTwitter && tw != "" {
+			if sd.Twitter == nil {
+				sd.Twitter = make(map[string]string)
+			}
+			if _, seen := sd.Twitter[tw]; !seen {
+				sd.Twitter[tw] = content
+			}
+		}
+	}
+}
+
+// parseJSONLD decodes one <script type="application/ld+json"> block, which may hold an
+// object, an array of objects, or an object with an @graph. Invalid JSON is ignored.
+func parseJSONLD(raw string) []StructuredItem {
+	var decoded any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &decoded); err != nil {
+		return nil
+	}
+
+	var items []StructuredItem
+	var collect func(v any)
+	collect = func(v any) {
+		switch v := v.(type) {
+		case []any:
+			for _, entry := range v {
+				collect(entry)
+			}
+		case map[string]any:
+			if graph, ok := v["@graph"]; ok {
+				collect(graph)
+				return
+			}
+			properties := make(map[string]any, len(v))
+			for key, value := range v {
+				if key != "@context" && key != "@type" {
+					properties[key] = value
+				}
+			}
+			items = append(items, StructuredItem{
+				Types:      schemaTypeNames(v["@type"]),
+				Source:     "json-ld",
+				Properties: properties,
+			})
+		}
+	}
+	collect(decoded)
+	return items
+}
+
+// schemaTypeNames turns an @type (string or list) into short names: "http://schema.org/Product" -> "Product"
+func schemaTypeNames(v any) []string {
+	var raw []string
+	switch v := v.(type) {
+	case string:
+		raw = []string{v}
+	case []any:
+		for _, entry := range v {
+			if s, ok := entry.(string); ok {
+				raw = append(raw, s)
+			}
+		}
+	}
+
+	types := make([]string, 0, len(raw))
+	for _, t := range raw {
+		for _, field := range strings.Fields(t) {
+			types = append(types, shortTypeName(field))
+		}
+	}
+	return types
+}
+
+// shortTypeName strips a vocabulary URL or prefix from a type name
+func shortTypeName(t string) string {
+	if i := strings.LastIndexAny(t, "/#"); i >= 0 && i < len(t)-1 {
+		t = t[i+1:]
+	}
+	if _, name, ok := strings.Cut(t, ":"); ok {
+		t = name
+	}
+	return t
+}
+
+// parseMicrodataItem reads an itemscope element and all the itemprops that belong to it
+func parseMicrodataItem(n *html.Node, base *url.URL) StructuredItem {
+	itemType, _ := getAttr(n, "itemtype")
+	item := StructuredItem{
+		Types:      schemaTypeNames(itemType),
+		Source:     "microdata",
+		Properties: make(map[string]any),
+	}
+	if id, ok := getAttr(n, "itemid"); ok {
+		item.Properties["@id"] = strings.TrimSpace(id)
+	}
+
+	add := func(name string, value any) {
+		switch existing := item.Properties[name].(type) {
+		case nil:
+			item.Properties[name] = value
+		case []any:
+			item.Properties[name] = append(existing, value)
+		default:
+			item.Properties[name] = []any{existing, value}
+		}
+	}
+
+	var walk func(c *html.Node)
+	walk = func(c *html.Node) {
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			props, hasProp := getAttr(child, "itemprop")
+			nested := hasAttr(child, "itemscope")
+
+			if hasProp {
+				var value any
+				if nested {
+					nestedItem := parseMicrodataItem(child, base)
+					// Written like JSON-LD: a single type is a plain string
+					if len(nestedItem.Types) == 1 {
+						nestedItem.Properties["@type"] = nestedItem.Types[0]
+					} else if len(nestedItem.Types) > 1 {
+						nestedItem.Properties["@type"] = nestedItem.Types
+					}
+					value = nestedItem.Properties
+				} else {
+					value = microdataValue(child, base)
+				}
+				for _, name := range strings.Fields(props) {
+					add(name, value)
+				}
+			}
+
+			// A nested item owns everything below it
+			if !nested {
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+
+	return item
+}
+
+// microdataValue reads an itemprop's value according to the element it sits on
+func microdataValue(n *html.Node, base *url.URL) string {
+	attr := ""
+	switch n.Data {
+	case "meta":
+		attr = "content"
+	case "a", "area", "link":
+		attr = "href"
+	case "img", "audio", "video", "source", "iframe", "embed", "track":
+		attr = "src"
+	case "object":
+		attr = "data"
+	case "time":
+		if _, ok := getAttr(n, "datetime"); ok {
+			attr = "datetime"
+		}
+	case "data", "meter":
+		attr = "value"
+	}
+	if attr == "" {
+		if content, ok := getAttr(n, "content"); ok {
+			return strings.TrimSpace(content)
+		}
+		return collapseSpace(textContent(n))
+	}
+
+	value, _ := getAttr(n, attr)
+	value = strings.TrimSpace(value)
+	if (attr == "href" || attr == "src" || attr == "data") && base != nil {
+		if resolved, err := base.Parse(value); err == nil {
+			return resolved.String()
+		}
+	}
+	return value
+}
+
+// hasAttr reports whether an element carries an attribute, even an empty one
+func hasAttr(n *html.Node, key string) bool {
+	_, ok := getAttr(n, key)
+	return ok
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// structuredData parses body as a page at pageURL and extracts its structured data
+func structuredData(t *testing.T, body, pageURL string) *StructuredData {
+	t.Helper()
+	doc, err := ParseHTML(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ExtractStructuredData(doc, pageURL)
+}
+
+func TestParseJSONLD(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		types [][]string
+	}{
+		{"object", `{"@context": "https://schema.org", "@type": "Product", "name": "Lamp"}`, [][]string{{"Product"}}},
+		{"array", `[{"@type": "Organization"}, {"@type": ["WebSite", "http://schema.org/WebPage"]}]`, [][]string{{"Organization"}, {"WebSite", "WebPage"}}},
+		{"graph", `{"@context": "https://schema.org", "@graph": [{"@type": "schema:Article"}, {"@type": "BreadcrumbList"}]}`, [][]string{{"Article"}, {"BreadcrumbList"}}},
+		{"no type", `{"name": "untyped"}`, [][]string{{}}},
+		{"invalid JSON", `{"@type": "Product",}`, nil},
+		{"scalar", `"just a string"`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := parseJSONLD(tt.raw)
+			if len(items) != len(tt.types) {
+				t.Fatalf("got %d items, want %d", len(items), len(tt.types))
+			}
+			for i, item := range items {
+				if !reflect.DeepEqual(item.Types, tt.types[i]) || item.Source != "json-ld" {
+					t.Errorf("item %d: types %q from %s, want %q from json-ld", i, item.Types, item.Source, tt.types[i])
+				}
+				if _, ok := item.Properties["@type"]; ok {
+					t.Errorf("item %d keeps @type among its properties", i)
+				}
+				if _, ok := item.Properties["@context"]; ok {
+					t.Errorf("item %d keeps @context among its properties", i)
+				}
+			}
+		})
+	}
+}
+
+func TestMicrodata(t *testing.T) {
+	sd := structuredData(t, `<html><body>
+		<div itemscope itemtype="https://schema.org/Product" itemid="urn:sku:42">
+			<h1 itemprop="name">  Desk
+				Lamp </h1>
+			<a itemprop="url" href="/lamp">Lamp</a>
+			<img itemprop="image" src="img/lamp.jpg">
+			<meta itemprop="sku" content="42">
+			<time itemprop="releaseDate" datetime="2026-03-01">March</time>
+			<span itemprop="color">red</span><span itemprop="color">blue</span>
+			<div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+				<data itemprop="price" value="19.99">$19.99</data>
+				<a itemprop="seller" href="https://shop.example/">Shop</a>
+			</div>
+		</div>
+		<p itemprop="orphan">not in any item</p>
+	</body></html>`, "https://example.com/catalogue/")
+
+	if len(sd.Items) != 1 {
+		t.Fatalf("got %d items, want only the top-level Product", len(sd.Items))
+	}
+	item := sd.Items[0]
+	if !reflect.DeepEqual(item.Types, []string{"Product"}) || item.Source != "microdata" {
+		t.Errorf("types %q from %s, want Product from microdata", item.Types, item.Source)
+	}
+	want := map[string]any{
+		"@id":         "urn:sku:42",
+		"name":        "Desk Lamp",
+		"url":         "https://example.com/lamp",
+		"image":       "https://example.com/catalogue/img/lamp.jpg",
+		"sku":         "42",
+		"releaseDate": "2026-03-01",
+		"color":       []any{"red", "blue"},
+		"offers": map[string]any{
+			"@type":  "Offer",
+			"price":  "19.99",
+			"seller": "https://shop.example/",
+		},
+	}
+	if !reflect.DeepEqual(item.Properties, want) {
+		t.Errorf("properties = %#v\nwant %#v", item.Properties, want)
+	}
+}
+
+func TestSocialMetaFirstValueWins(t *testing.T) {
+	sd := structuredData(t, `<html><head>
+		<meta property="og:title" content="First title">
+		<meta property="og:title" content="Second title">
+		<meta name="og:type" content="article">
+		<meta property="OG:Image" content="https://example.com/a.png">
+		<meta property="og:description" content="  ">
+		<meta property="og:description" content="Real description">
+		<meta name="twitter:card" content="summary">
+		<meta name="twitter:card" content="player">
+		<meta property="og:" content="no key">
+	</head></html>`, "https://example.com/")
+
+	wantOG := map[string]string{"title": "First title", "type": "article", "image": "https://example.com/a.png", "description": "Real description"}
+	if !reflect.DeepEqual(sd.OpenGraph, wantOG) {
+		t.Errorf("OpenGraph = %v, want %v", sd.OpenGraph, wantOG)
+	}
+	if !reflect.DeepEqual(sd.Twitter, map[string]string{"card": "summary"}) {
+		t.Errorf("Twitter = %v, want the first card only", sd.Twitter)
+	}
+}
+
+func TestSchemaTypes(t *testing.T) {
+	sd := structuredData(t, `<html><head>
+		<meta property="og:type" content="product">
+		<script type="application/ld+json">[{"@type": "Product"}, {"@type": ["Product", "Offer"]}]</script>
+		<script type="application/ld+json">not json</script>
+	</head><body>
+		<div itemscope itemtype="https://schema.org/BreadcrumbList"></div>
+	</body></html>`, "https://example.com/")
+
+	want := []string{"BreadcrumbList", "Offer", "Product", "og:product"}
+	if got := sd.SchemaTypes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SchemaTypes() = %q, want %q", got, want)
+	}
+	if types := (*StructuredData)(nil).SchemaTypes(); types != nil {
+		t.Errorf("nil data has types %q", types)
+	}
+	if empty := structuredData(t, `<html><body><p>plain</p></body></html>`, "https://example.com/"); !empty.IsEmpty() {
+		t.Error("plain page has structured data")
+	}
+}